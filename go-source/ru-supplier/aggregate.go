@@ -0,0 +1,79 @@
+package main
+
+import "sort"
+
+const (
+	// slug of feed with orders of all saved searches
+	_AGGREGATE_ALL_SLUG = "all"
+	// slug prefix of feeds with orders of saved search groups
+	_AGGREGATE_GROUP_SLUG = "group"
+
+	_AGGREGATE_ALL_TITLE   = "Все закупки"
+	_AGGREGATE_GROUP_TITLE = "Закупки: "
+)
+
+// Merger merges orders of several saved searches removing duplicates
+// and remembers which searches have found each order
+type Merger struct {
+	orders   []*Order
+	searches map[string][]string // search names by order key
+}
+
+func NewMerger() *Merger {
+	return &Merger{searches: make(map[string][]string)}
+}
+
+// Add adds orders found by saved search with passed name
+func (m *Merger) Add(name string, orders []*Order) {
+	for _, order := range orders {
+		key := order.Key()
+		names, ok := m.searches[key]
+		if !ok {
+			m.orders = append(m.orders, order)
+		}
+		m.searches[key] = append(names, name)
+	}
+}
+
+// Has reports whether order with passed key is merged
+func (m *Merger) Has(key string) bool {
+	_, ok := m.searches[key]
+	return ok
+}
+
+// Len returns count of merged orders
+func (m *Merger) Len() int {
+	return len(m.orders)
+}
+
+// Orders returns at most limit of the newest merged orders sorted by
+// publish date descending and names of searches by order key
+func (m *Merger) Orders(limit int) ([]*Order, map[string][]string) {
+	sort.Stable(ordersByPubDate(m.orders))
+	if len(m.orders) > limit {
+		m.orders = m.orders[:limit]
+	}
+	return m.orders, m.searches
+}
+
+type ordersByPubDate []*Order
+
+func (s ordersByPubDate) Len() int      { return len(s) }
+func (s ordersByPubDate) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s ordersByPubDate) Less(i, j int) bool {
+	return s[i].PubDate.After(s[j].PubDate)
+}
+
+// GroupSearches returns saved searches which belong to group
+func GroupSearches(list []*SavedSearch, group string) []*SavedSearch {
+	var found []*SavedSearch
+	for _, ss := range list {
+		for _, g := range ss.Groups {
+			if g == group {
+				found = append(found, ss)
+				break
+			}
+		}
+	}
+	return found
+}
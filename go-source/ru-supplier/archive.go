@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	_ARCHIVE_FILE_NAME    = "archive.db"
+	_ARCHIVE_OPEN_TIMEOUT = time.Second
+	// max count of orders returned by search
+	_ARCHIVE_SEARCH_LIMIT = 200
+	// min length of indexed word in characters
+	_ARCHIVE_MIN_WORD_LENGTH = 2
+)
+
+var (
+	_ARCHIVE_BUCKET_ORDERS = []byte("orders")
+	_ARCHIVE_BUCKET_INDEX  = []byte("index")
+	// feed histories and subscriber cursors, see history.go
+	_ARCHIVE_BUCKET_FEEDS   = []byte("feeds")
+	_ARCHIVE_BUCKET_CURSORS = []byte("cursors")
+	// starred orders, see stars.go
+	_ARCHIVE_BUCKET_STARS = []byte("stars")
+)
+
+// Separator between word and order key in full-text index
+const _ARCHIVE_INDEX_SEPARATOR = 0
+
+// ArchiveRecord is order saved in archive
+type ArchiveRecord struct {
+	Order
+	// Errors shadows Order.Errors because type error cannot be decoded
+	Errors   []string
+	Archived time.Time // time of first saving
+	Updated  time.Time // time of last saving
+}
+
+func NewArchiveRecord(order *Order) *ArchiveRecord {
+	record := &ArchiveRecord{Order: *order}
+	record.Order.Errors = nil
+	for _, err := range order.Errors {
+		record.Errors = append(record.Errors, err.Error())
+	}
+	return record
+}
+
+// ToOrder returns order with restored errors
+func (record *ArchiveRecord) ToOrder() *Order {
+	order := record.Order
+	order.Errors = nil
+	for _, msg := range record.Errors {
+		order.PushError(errors.New(msg))
+	}
+	return &order
+}
+
+// words returns indexed words of order
+func (record *ArchiveRecord) words() []string {
+	return SplitWords(record.OrderName, record.OrganisationName,
+		record.OKPD, record.Features)
+}
+
+// SplitWords splits passed strings into unique lower case words
+func SplitWords(strs ...string) []string {
+	var (
+		words []string
+		seen  = make(map[string]bool)
+	)
+	for _, str := range strs {
+		for _, word := range strings.FieldsFunc(strings.ToLower(str),
+			func(r rune) bool {
+				return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+			}) {
+			if utf8.RuneCountInString(word) < _ARCHIVE_MIN_WORD_LENGTH {
+				continue
+			}
+			if !seen[word] {
+				seen[word] = true
+				words = append(words, word)
+			}
+		}
+	}
+	return words
+}
+
+// ArchiveQuery contains search string and filters for archive search
+type ArchiveQuery struct {
+	Text      string     // words which must be found in order
+	Laws      []OrderLaw // empty for any law
+	PriceFrom Price      // zero for any price
+	PriceTo   Price      // zero for any price
+	DateFrom  time.Time  // min publish date or zero
+	DateTo    time.Time  // max publish date or zero
+}
+
+// Match returns true if order satisfies query filters. Match doesn't
+// check words
+func (q *ArchiveQuery) Match(order *Order) bool {
+	if len(q.Laws) > 0 {
+		var ok bool
+		for _, law := range q.Laws {
+			if order.LawId == law {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if q.PriceFrom > 0 && order.StartOrderPrice < q.PriceFrom {
+		return false
+	}
+	if q.PriceTo > 0 && order.StartOrderPrice > q.PriceTo {
+		return false
+	}
+	if !q.DateFrom.IsZero() && order.PubDate.Before(q.DateFrom) {
+		return false
+	}
+	if !q.DateTo.IsZero() && order.PubDate.After(q.DateTo) {
+		return false
+	}
+	return true
+}
+
+// Archive stores all parsed orders in embedded database with
+// full-text index
+type Archive struct {
+	db *bolt.DB
+}
+
+func OpenArchive(fname string) (*Archive, error) {
+	if len(fname) == 0 {
+		panic("Archive: invalid file name")
+	}
+
+	db, err := bolt.Open(fname, 0600, &bolt.Options{
+		Timeout: _ARCHIVE_OPEN_TIMEOUT,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{
+			_ARCHIVE_BUCKET_ORDERS,
+			_ARCHIVE_BUCKET_INDEX,
+			_ARCHIVE_BUCKET_FEEDS,
+			_ARCHIVE_BUCKET_CURSORS,
+			_ARCHIVE_BUCKET_STARS,
+		} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Archive{db}, nil
+}
+
+func indexKey(word, key string) []byte {
+	return append(append([]byte(word), _ARCHIVE_INDEX_SEPARATOR),
+		key...)
+}
+
+// Store saves or updates passed orders and reindexes them
+func (a *Archive) Store(orders []*Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	return a.db.Update(func(tx *bolt.Tx) error {
+		_, err := storeOrders(tx, orders)
+		return err
+	})
+}
+
+// storeOrders saves or updates orders in transaction tx and returns
+// saved records in the same order
+func storeOrders(tx *bolt.Tx, orders []*Order) ([]*ArchiveRecord, error) {
+	bOrders := tx.Bucket(_ARCHIVE_BUCKET_ORDERS)
+	bIndex := tx.Bucket(_ARCHIVE_BUCKET_INDEX)
+	now := time.Now()
+	records := make([]*ArchiveRecord, len(orders))
+
+	for i, order := range orders {
+		key := order.Key()
+		record := NewArchiveRecord(order)
+		records[i] = record
+		record.Archived = now
+		record.Updated = now
+
+		if data := bOrders.Get([]byte(key)); data != nil {
+			var old ArchiveRecord
+			if err := json.Unmarshal(data, &old); err == nil {
+				record.Archived = old.Archived
+				for _, word := range old.words() {
+					err = bIndex.Delete(indexKey(word, key))
+					if err != nil {
+						return nil, err
+					}
+				}
+			}
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		if err = bOrders.Put([]byte(key), data); err != nil {
+			return nil, err
+		}
+		for _, word := range record.words() {
+			if err = bIndex.Put(indexKey(word, key), nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return records, nil
+}
+
+// Get returns archived order by key or nil if order was not found
+func (a *Archive) Get(key string) (record *ArchiveRecord, err error) {
+	err = a.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(_ARCHIVE_BUCKET_ORDERS).Get([]byte(key))
+		if data == nil {
+			return nil
+		}
+		record = new(ArchiveRecord)
+		return json.Unmarshal(data, record)
+	})
+	return
+}
+
+// Search finds orders which contain all query words as word
+// prefixes and satisfy query filters. Result is sorted by publish date
+// descending
+func (a *Archive) Search(q *ArchiveQuery) ([]*ArchiveRecord, error) {
+	if q == nil {
+		return nil, errors.New("Archive: passed nil query")
+	}
+
+	var records []*ArchiveRecord
+
+	err := a.db.View(func(tx *bolt.Tx) error {
+		bOrders := tx.Bucket(_ARCHIVE_BUCKET_ORDERS)
+
+		check := func(data []byte) error {
+			record := new(ArchiveRecord)
+			if err := json.Unmarshal(data, record); err != nil {
+				return err
+			}
+			if q.Match(&record.Order) {
+				records = append(records, record)
+			}
+			return nil
+		}
+
+		words := SplitWords(q.Text)
+		if len(words) == 0 {
+			return bOrders.ForEach(func(_, data []byte) error {
+				return check(data)
+			})
+		}
+
+		var keys map[string]bool
+		for _, word := range words {
+			found := make(map[string]bool)
+			prefix := []byte(word)
+			c := tx.Bucket(_ARCHIVE_BUCKET_INDEX).Cursor()
+			for k, _ := c.Seek(prefix); k != nil &&
+				bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+				i := bytes.IndexByte(k, _ARCHIVE_INDEX_SEPARATOR)
+				if i == -1 {
+					continue
+				}
+				key := string(k[i+1:])
+				if keys == nil || keys[key] {
+					found[key] = true
+				}
+			}
+			keys = found
+			if len(keys) == 0 {
+				return nil
+			}
+		}
+
+		for key := range keys {
+			if data := bOrders.Get([]byte(key)); data != nil {
+				if err := check(data); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(archiveRecordsByPubDate(records))
+	if len(records) > _ARCHIVE_SEARCH_LIMIT {
+		records = records[:_ARCHIVE_SEARCH_LIMIT]
+	}
+	return records, nil
+}
+
+// Count returns count of archived orders
+func (a *Archive) Count() (count int, err error) {
+	err = a.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(_ARCHIVE_BUCKET_ORDERS).Stats().KeyN
+		return nil
+	})
+	return
+}
+
+func (a *Archive) Close() error {
+	return a.db.Close()
+}
+
+type archiveRecordsByPubDate []*ArchiveRecord
+
+func (s archiveRecordsByPubDate) Len() int      { return len(s) }
+func (s archiveRecordsByPubDate) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s archiveRecordsByPubDate) Less(i, j int) bool {
+	if s[i].PubDate.Equal(s[j].PubDate) {
+		return s[i].Updated.After(s[j].Updated)
+	}
+	return s[i].PubDate.After(s[j].PubDate)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Param of feed links with access token of user
+const _AUTH_TOKEN_PARAM = "access_token"
+
+const _AUTH_REALM = "ru-supplier"
+
+// Paths which accept access token: rss clients can't use basic auth
+// everywhere, so feeds, links of feed items and events accept token in
+// link
+var tokenPaths = []string{
+	_PATH_TO_RSS,
+	_PATH_TO_FEEDS + "/",
+	_PATH_TO_SHORT_LINKS,
+	_PATH_TO_EVENTS,
+}
+
+// Paths which are available without authentication for health checks
+var publicPaths = []string{
+	_PATH_TO_HEALTHZ,
+	_PATH_TO_READYZ,
+}
+
+// User has access to proxy. Password is checked with HTTP basic auth on
+// each path, Token is checked in feed links with param access_token
+type User struct {
+	Name     string
+	Password string `json:",omitempty"`
+	Token    string `json:",omitempty"`
+}
+
+// Verify checks user fields
+func (u *User) Verify() error {
+	if len(u.Name) == 0 {
+		return errors.New("User: empty name")
+	}
+	if len(u.Password) == 0 && len(u.Token) == 0 {
+		return errors.New("User: password or token required")
+	}
+	return nil
+}
+
+// Auth authenticates requests by users. If there are no users all
+// requests are allowed
+type Auth struct {
+	users []*User
+}
+
+func NewAuth(users []*User) *Auth {
+	return &Auth{users}
+}
+
+// Enabled returns true if requests must be authenticated
+func (a *Auth) Enabled() bool {
+	return len(a.users) > 0
+}
+
+// Required returns true if request to path must be authenticated
+func (a *Auth) Required(path string) bool {
+	if !a.Enabled() {
+		return false
+	}
+	for _, public := range publicPaths {
+		if path == public {
+			return false
+		}
+	}
+	return true
+}
+
+// Authenticate returns user of request or nil if request isn't
+// authenticated
+func (a *Auth) Authenticate(r *http.Request) *User {
+	if name, password, ok := r.BasicAuth(); ok {
+		for _, user := range a.users {
+			if len(user.Password) > 0 && equalSecrets(user.Name, name) &&
+				equalSecrets(user.Password, password) {
+				return user
+			}
+		}
+		return nil
+	}
+	if !acceptsToken(r.URL.Path) {
+		return nil
+	}
+	return a.TokenUser(r.URL.Query().Get(_AUTH_TOKEN_PARAM))
+}
+
+// TokenUser returns user with access token or nil
+func (a *Auth) TokenUser(token string) *User {
+	if len(token) == 0 {
+		return nil
+	}
+	for _, user := range a.users {
+		if len(user.Token) > 0 && equalSecrets(user.Token, token) {
+			return user
+		}
+	}
+	return nil
+}
+
+// Deny asks client to authenticate
+func (a *Auth) Deny(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate",
+		`Basic realm="`+_AUTH_REALM+`", charset="UTF-8"`)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+}
+
+func acceptsToken(path string) bool {
+	for _, prefix := range tokenPaths {
+		if path == prefix || strings.HasSuffix(prefix, "/") &&
+			strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func equalSecrets(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// AddAccessToken adds access token to link. Link isn't changed if token
+// is empty
+func AddAccessToken(link, token string) string {
+	if len(token) == 0 {
+		return link
+	}
+	sep := "?"
+	if strings.Contains(link, "?") {
+		sep = "&"
+	}
+	return link + sep + _AUTH_TOKEN_PARAM + "=" + url.QueryEscape(token)
+}
@@ -5,12 +5,20 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
 	"os"
+	"sync"
 )
 
-const _HASH_STORE_FILE_NAME = "cache.json"
+const (
+	_HASH_STORE_FILE_NAME = "cache.json"
+	// suffix of temporary file which is renamed into store file
+	_HASH_STORE_TEMP_SUFFIX = ".tmp"
+	// suffix of file into which corrupted store file is moved
+	_HASH_STORE_CORRUPT_SUFFIX = ".corrupt"
+)
 
 // CacheReader reads while does not find chunk which md5 hash sum
 // will matches with passed checking hash
@@ -69,14 +77,17 @@ type HashPair struct {
 }
 
 // HashStore stores urls and chunks on which "feed" was ended at last
-// time. HashStore saves info in json file fname
+// time. HashStore saves info in json file fname. HashStore is safe for
+// concurrent use
 type HashStore struct {
-	fname string // file name
-	data  []*HashPair
+	mutex     sync.RWMutex // guards data
+	fileMutex sync.Mutex   // serializes file writing
+	fname     string       // file name
+	data      []*HashPair
 }
 
-func LoadHashStoreSimple() *HashStore {
-	hs, err := LoadHashStore(_HASH_STORE_FILE_NAME)
+func LoadHashStoreSimple(fname string) *HashStore {
+	hs, err := LoadHashStore(fname)
 	if hs == nil {
 		if err != nil {
 			log.Fatal("Cannot load hashstore:", err)
@@ -95,7 +106,7 @@ func LoadHashStore(fname string) (hs *HashStore, err error) {
 		panic("Hashstore: invalid file name")
 	}
 
-	hs = &HashStore{fname, nil}
+	hs = &HashStore{fname: fname}
 
 	var file *os.File
 	file, err = os.Open(fname)
@@ -105,14 +116,23 @@ func LoadHashStore(fname string) (hs *HashStore, err error) {
 		}
 		return
 	}
-	defer file.Close()
 
 	var data map[string]string
-	if err = json.NewDecoder(file).Decode(&data); err != nil {
+	err = json.NewDecoder(file).Decode(&data)
+	file.Close()
+	if err != nil {
 		if err == io.EOF {
-			err = nil
+			return hs, nil
 		}
-		return
+		// file is corrupted: store starts with empty data and broken
+		// file is kept for investigation
+		if errMove := os.Rename(fname,
+			fname+_HASH_STORE_CORRUPT_SUFFIX); errMove != nil {
+			return hs, fmt.Errorf("corrupted file %s: %s; "+
+				"cannot move: %s", fname, err, errMove)
+		}
+		return hs, fmt.Errorf("corrupted file %s was moved to %s: %s",
+			fname, fname+_HASH_STORE_CORRUPT_SUFFIX, err)
 	}
 
 	hs.data = make([]*HashPair, 0)
@@ -131,22 +151,43 @@ func LoadHashStore(fname string) (hs *HashStore, err error) {
 	return
 }
 
+// Save writes store into temporary file and renames it into store
+// file, so store file is never written partially
 func (hs *HashStore) Save() error {
-	if len(hs.data) == 0 {
-		hs.Remove()
+	hs.fileMutex.Lock()
+	defer hs.fileMutex.Unlock()
+
+	hs.mutex.RLock()
+	data := make(map[string]string)
+	for _, pair := range hs.data {
+		data[hex.EncodeToString(pair.url)] =
+			hex.EncodeToString(pair.chunk)
+	}
+	hs.mutex.RUnlock()
+
+	if len(data) == 0 {
+		if err := os.Remove(hs.fname); err != nil && !os.IsNotExist(err) {
+			return err
+		}
 		return nil
 	}
-	file, err := os.Create(hs.fname)
+
+	tmpname := hs.fname + _HASH_STORE_TEMP_SUFFIX
+	file, err := os.Create(tmpname)
 	if err != nil {
 		return err
 	}
-	defer file.Close()
-	data := make(map[string]string)
-	for _, pair := range hs.data {
-		data[hex.EncodeToString(pair.url)] =
-			hex.EncodeToString(pair.chunk)
+	if err = json.NewEncoder(file).Encode(data); err == nil {
+		err = file.Sync()
 	}
-	return json.NewEncoder(file).Encode(data)
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(tmpname)
+		return err
+	}
+	return os.Rename(tmpname, hs.fname)
 }
 
 func (hs *HashStore) GetHashChunk(rawurl string) ([]byte, bool) {
@@ -154,6 +195,8 @@ func (hs *HashStore) GetHashChunk(rawurl string) ([]byte, bool) {
 		hash := md5.New()
 		io.WriteString(hash, rawurl)
 		url := hash.Sum(nil)
+		hs.mutex.RLock()
+		defer hs.mutex.RUnlock()
 		for _, pair := range hs.data {
 			if bytes.Compare(pair.url, url) == 0 {
 				return pair.chunk, true
@@ -174,6 +217,8 @@ func (hs *HashStore) SetHashChunk(rawurl string, chunk []byte) {
 	hash.Reset()
 	hash.Write(chunk)
 	chunk = hash.Sum(nil)
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
 	for _, pair := range hs.data {
 		if bytes.Compare(pair.url, url) == 0 {
 			// set existian pair
@@ -185,8 +230,19 @@ func (hs *HashStore) SetHashChunk(rawurl string, chunk []byte) {
 	hs.data = append(hs.data, &HashPair{url, chunk})
 }
 
+// Len returns count of feeds in store
+func (hs *HashStore) Len() int {
+	hs.mutex.RLock()
+	defer hs.mutex.RUnlock()
+	return len(hs.data)
+}
+
 // Remove removes all cache
 func (hs *HashStore) Remove() error {
+	hs.fileMutex.Lock()
+	defer hs.fileMutex.Unlock()
+	hs.mutex.Lock()
 	hs.data = nil
+	hs.mutex.Unlock()
 	return os.Remove(hs.fname)
 }
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// fetchCall is in-flight fetching of one feed
+type fetchCall struct {
+	done    chan struct{}
+	orders  []*Order
+	err     error
+	waiters int // count of callers which wait for result
+	cancel  context.CancelFunc
+}
+
+// FetchGroup coalesces concurrent fetches of same url: only first
+// caller fetches feed, the others wait and receive the same orders
+type FetchGroup struct {
+	mutex sync.Mutex
+	calls map[string]*fetchCall
+}
+
+func NewFetchGroup() *FetchGroup {
+	return &FetchGroup{calls: make(map[string]*fetchCall)}
+}
+
+// Do calls fetch if there is no in-flight fetching of rawurl and waits
+// for result of in-flight fetching otherwise. Each caller receives own
+// copy of order list, so callers can filter it independently. Caller
+// stops waiting when its ctx is done, fetching is cancelled when all
+// callers stop waiting
+func (g *FetchGroup) Do(ctx context.Context, rawurl string,
+	fetch func(context.Context) ([]*Order, error)) ([]*Order, error) {
+	g.mutex.Lock()
+	call, ok := g.calls[rawurl]
+	if !ok {
+		var fetchCtx context.Context
+		call = &fetchCall{done: make(chan struct{})}
+		fetchCtx, call.cancel = context.WithCancel(context.Background())
+		g.calls[rawurl] = call
+		go func() {
+			orders, err := fetch(fetchCtx)
+			g.mutex.Lock()
+			if g.calls[rawurl] == call {
+				delete(g.calls, rawurl)
+			}
+			g.mutex.Unlock()
+			call.orders, call.err = orders, err
+			call.cancel()
+			close(call.done)
+		}()
+	}
+	call.waiters++
+	g.mutex.Unlock()
+
+	select {
+	case <-call.done:
+		return append([]*Order(nil), call.orders...), call.err
+	case <-ctx.Done():
+		g.mutex.Lock()
+		if call.waiters--; call.waiters == 0 {
+			// nobody waits for result, next caller starts new fetching
+			if g.calls[rawurl] == call {
+				delete(g.calls, rawurl)
+			}
+			call.cancel()
+		}
+		g.mutex.Unlock()
+		return nil, ctx.Err()
+	}
+}
@@ -3,34 +3,89 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"net/url"
 	"os"
+	"strings"
+	"time"
 )
 
 var ErrInvalidConfig = errors.New("Invalid config")
 
 type ServerConfig interface {
 	GetHost() string
-	HTTPHost() string
 	GetPort() string
+	GetBaseURL() string
 	IsFilterEnabled() bool
 	SetFilterEnabled(bool)
+	GetFeedWindow() (items, days int)
+	GetPollInterval() time.Duration
+	GetPollConcurrency() int
+	GetWebhooks() []*WebhookTarget
+	GetSMTP() *SMTPConfig
+	GetDigests() []*DigestConfig
+	GetStarReminders() []int
+	GetStarAlertsTo() []string
+	GetDataDir() string
+	GetCacheFile() string
+	GetDocsDir() string
+	GetFilterProfilesDir() string
+	GetTLS() *TLSConfig
+	GetUsers() []*User
 	Save() error
 }
 
 // Config contains configurations
 // If you want use ptogram with any rss client port must be 80
 // (some rss clients require this)
+// FeedWindowItems and FeedWindowDays limit count and age of orders
+// which are served in feeds without access token in link. Feeds with
+// access token contain orders which were not served to its owner yet
+// PollInterval is default interval in minutes of polling of saved
+// searches, PollConcurrency is max count of concurrent polls
+// Webhooks contains targets which receive new orders, see webhooks.go
+// SMTP contains mail server settings for email digests of saved
+// searches from Digests, see digest.go
+// StarReminders contains hours before filing deadline when reminders
+// about starred orders are sent, StarAlertsTo contains emails which
+// receive reminders and alerts, see stars.go
+// Host and Port are listen address, BaseURL is public address of proxy
+// with scheme and optional path prefix which is used in links, for
+// example https://tenders.example.local/ru. If BaseURL is empty links
+// are made with Host and Port
+// TLS enables https, see tls.go. If Users isn't empty requests are
+// authenticated with passwords and tokens of users, see auth.go
 type Config struct {
-	fname         string
-	Host, Port    string
-	FilterEnabled bool
+	fname           string
+	paths           ConfigPaths
+	listenHost      string // overrides Host, isn't saved
+	listenPort      string // overrides Port, isn't saved
+	baseURL         string // overrides BaseURL, isn't saved
+	Host, Port      string
+	BaseURL         string `json:",omitempty"`
+	FilterEnabled   bool
+	FeedWindowItems int
+	FeedWindowDays  int
+	PollInterval    int
+	PollConcurrency int
+	Webhooks        []*WebhookTarget `json:",omitempty"`
+	SMTP            *SMTPConfig      `json:",omitempty"`
+	Digests         []*DigestConfig  `json:",omitempty"`
+	StarReminders   []int
+	StarAlertsTo    []string   `json:",omitempty"`
+	TLS             *TLSConfig `json:",omitempty"`
+	Users           []*User    `json:",omitempty"`
 }
 
 // Default config
 var defaultConfig = &Config{
-	Host:          "proxy-zakupki-gov-ru.local",
-	Port:          "80",
-	FilterEnabled: true,
+	Host:            "proxy-zakupki-gov-ru.local",
+	Port:            "80",
+	FilterEnabled:   true,
+	FeedWindowItems: 100,
+	FeedWindowDays:  0,
+	PollInterval:    30,
+	PollConcurrency: 2,
+	StarReminders:   []int{72, 24},
 }
 
 func LoadConfig(fname string) (conf *Config, err error) {
@@ -39,7 +94,7 @@ func LoadConfig(fname string) (conf *Config, err error) {
 	}
 
 	conf = new(Config)
-	*conf = *defaultConfig
+	conf.setDefault()
 
 	var file *os.File
 	file, err = os.Open(fname)
@@ -52,7 +107,7 @@ func LoadConfig(fname string) (conf *Config, err error) {
 
 		if err = json.NewDecoder(file).Decode(&conf); err == nil {
 			if !conf.Valid() {
-				*conf = *defaultConfig
+				conf.setDefault()
 				err = ErrInvalidConfig
 			}
 		}
@@ -62,6 +117,13 @@ func LoadConfig(fname string) (conf *Config, err error) {
 	return
 }
 
+// setDefault sets default values. Slices are copied, so decoding of
+// config file doesn't change default config
+func (c *Config) setDefault() {
+	*c = *defaultConfig
+	c.StarReminders = append([]int(nil), defaultConfig.StarReminders...)
+}
+
 func (c *Config) Save() error {
 	if !c.Valid() {
 		return ErrInvalidConfig
@@ -84,21 +146,153 @@ func (c *Config) Save() error {
 func (c *Config) LikeDefault() bool {
 	return c.Host == defaultConfig.Host &&
 		c.Port == defaultConfig.Port &&
-		c.FilterEnabled == defaultConfig.FilterEnabled
+		c.FilterEnabled == defaultConfig.FilterEnabled &&
+		c.FeedWindowItems == defaultConfig.FeedWindowItems &&
+		c.FeedWindowDays == defaultConfig.FeedWindowDays &&
+		c.PollInterval == defaultConfig.PollInterval &&
+		c.PollConcurrency == defaultConfig.PollConcurrency &&
+		len(c.Webhooks) == 0 &&
+		c.SMTP == nil && len(c.Digests) == 0 &&
+		equalInts(c.StarReminders, defaultConfig.StarReminders) &&
+		len(c.StarAlertsTo) == 0 && len(c.BaseURL) == 0 &&
+		c.TLS == nil && len(c.Users) == 0
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 func (c *Config) Valid() bool {
-	return len(c.Host)*len(c.Port) > 0
+	if len(c.BaseURL) > 0 && VerifyBaseURL(c.BaseURL) != nil {
+		return false
+	}
+	names := make(map[string]bool)
+	for _, target := range c.Webhooks {
+		if target == nil || target.Verify() != nil || names[target.Name] {
+			return false
+		}
+		names[target.Name] = true
+	}
+	if c.SMTP != nil && c.SMTP.Verify() != nil {
+		return false
+	}
+	for _, digest := range c.Digests {
+		if digest == nil || c.SMTP == nil || digest.Verify() != nil {
+			return false
+		}
+	}
+	for _, hours := range c.StarReminders {
+		if hours <= 0 {
+			return false
+		}
+	}
+	if len(c.StarAlertsTo) > 0 && c.SMTP == nil {
+		return false
+	}
+	if c.TLS != nil && c.TLS.Verify() != nil {
+		return false
+	}
+	names = make(map[string]bool)
+	tokens := make(map[string]bool)
+	for _, user := range c.Users {
+		if user == nil || user.Verify() != nil || names[user.Name] ||
+			len(user.Token) > 0 && tokens[user.Token] {
+			return false
+		}
+		names[user.Name] = true
+		tokens[user.Token] = true
+	}
+	return len(c.Host)*len(c.Port) > 0 &&
+		c.FeedWindowItems >= 0 && c.FeedWindowDays >= 0 &&
+		c.PollInterval > 0 && c.PollConcurrency > 0
+}
+
+// ConfigPaths contains paths of data files which are not stored in
+// config file
+type ConfigPaths struct {
+	DataDir           string
+	CacheFile         string
+	FilterProfilesDir string
+	DocsDir           string
+}
+
+// Override sets paths of data files and overrides listen host, port and
+// base url of config file by non-empty values. Overridden values are
+// not saved
+func (c *Config) Override(paths ConfigPaths, host, port, baseURL string) {
+	c.paths = paths
+	c.listenHost, c.listenPort, c.baseURL = host, port, baseURL
+}
+
+func (c *Config) GetHost() string {
+	if len(c.listenHost) > 0 {
+		return c.listenHost
+	}
+	return c.Host
+}
+
+func (c *Config) GetPort() string {
+	if len(c.listenPort) > 0 {
+		return c.listenPort
+	}
+	return c.Port
 }
 
 func (c *Config) HTTPHost() (host string) {
-	host = c.Host
-	if c.Port != "80" {
-		host += ":" + c.Port
+	host = c.GetHost()
+	if port := c.GetPort(); port != "80" {
+		host += ":" + port
 	}
 	return
 }
 
+// HTTPSHost returns host with port if port isn't default https port
+func (c *Config) HTTPSHost() (host string) {
+	host = c.GetHost()
+	if port := c.GetPort(); port != "443" {
+		host += ":" + port
+	}
+	return
+}
+
+// GetBaseURL returns public address of proxy without trailing slash
+func (c *Config) GetBaseURL() string {
+	base := c.baseURL
+	if len(base) == 0 {
+		base = c.BaseURL
+	}
+	if len(base) == 0 {
+		if c.TLS != nil {
+			return "https://" + c.HTTPSHost()
+		}
+		return "http://" + c.HTTPHost()
+	}
+	return strings.TrimRight(base, "/")
+}
+
+// VerifyBaseURL checks that base url is absolute http or https url
+// without query
+func VerifyBaseURL(base string) error {
+	URL, err := url.Parse(base)
+	if err != nil {
+		return err
+	}
+	if URL.Scheme != "http" && URL.Scheme != "https" ||
+		len(URL.Host) == 0 || len(URL.RawQuery) > 0 ||
+		len(URL.Fragment) > 0 {
+		return errors.New("Invalid base url " + base)
+	}
+	return nil
+}
+
 func (c *Config) SetFilterEnabled(flag bool) {
 	c.FilterEnabled = flag
 }
@@ -107,12 +301,66 @@ func (c *Config) IsFilterEnabled() bool {
 	return c.FilterEnabled
 }
 
-func (c *Config) GetHost() string {
-	return c.Host
+func (c *Config) GetFeedWindow() (items, days int) {
+	return c.FeedWindowItems, c.FeedWindowDays
 }
 
-func (c *Config) GetPort() string {
-	return c.Port
+func (c *Config) GetPollInterval() time.Duration {
+	return time.Duration(c.PollInterval) * time.Minute
+}
+
+func (c *Config) GetPollConcurrency() int {
+	return c.PollConcurrency
+}
+
+func (c *Config) GetWebhooks() []*WebhookTarget {
+	return c.Webhooks
+}
+
+func (c *Config) GetSMTP() *SMTPConfig {
+	return c.SMTP
+}
+
+func (c *Config) GetDigests() []*DigestConfig {
+	return c.Digests
+}
+
+func (c *Config) GetStarReminders() []int {
+	return c.StarReminders
+}
+
+func (c *Config) GetDataDir() string {
+	return c.paths.DataDir
+}
+
+func (c *Config) GetCacheFile() string {
+	if len(c.paths.CacheFile) == 0 {
+		return _HASH_STORE_FILE_NAME
+	}
+	return c.paths.CacheFile
+}
+
+func (c *Config) GetDocsDir() string {
+	if len(c.paths.DocsDir) == 0 {
+		return _DOCS_DIR
+	}
+	return c.paths.DocsDir
+}
+
+func (c *Config) GetFilterProfilesDir() string {
+	return c.paths.FilterProfilesDir
+}
+
+func (c *Config) GetStarAlertsTo() []string {
+	return c.StarAlertsTo
+}
+
+func (c *Config) GetTLS() *TLSConfig {
+	return c.TLS
+}
+
+func (c *Config) GetUsers() []*User {
+	return c.Users
 }
 
 // func (c *Config) SetHost(host string) {
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"html/template"
+	"io"
+	"time"
+)
+
+// Directory with documentation which is served at /docs/, it is near
+// program by default
+const _DOCS_DIR = "docs"
+
+// Dashboard actions, they mirror actions of tray menu
+const (
+	_DASHBOARD_ACTION_RESUME         = "resume"
+	_DASHBOARD_ACTION_PAUSE          = "pause"
+	_DASHBOARD_ACTION_FILTER_ENABLE  = "filter_enable"
+	_DASHBOARD_ACTION_FILTER_DISABLE = "filter_disable"
+	_DASHBOARD_ACTION_REMOVE_CACHE   = "remove_cache"
+	_DASHBOARD_ACTION_EXIT           = "exit"
+)
+
+// Form param with token which protects dashboard actions from cross
+// site requests
+const _DASHBOARD_CSRF_PARAM = "csrf"
+
+// length of form token in bytes
+const _DASHBOARD_CSRF_LENGTH = 16
+
+// Notices which are shown after actions, they are the same as notices
+// of tray menu
+const _DASHBOARD_NOTICE_EXIT = "Программа завершается"
+
+var dashboardNotices = map[string]string{
+	_DASHBOARD_ACTION_RESUME:         "Локальный прокси запущен",
+	_DASHBOARD_ACTION_PAUSE:          "Локальный прокси остановлен",
+	_DASHBOARD_ACTION_FILTER_ENABLE:  "Фильтр включен",
+	_DASHBOARD_ACTION_FILTER_DISABLE: "Фильтр выключен",
+	_DASHBOARD_ACTION_REMOVE_CACHE: "Кэш удален, программа некоторое " +
+		"время будет загружать и обрабатывать все доступные закупки",
+}
+
+var dashboardTmpl = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		if t.IsZero() {
+			return "—"
+		}
+		return t.Format("02.01.2006 15:04:05")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="utf-8" />
+		<title>Внимательный Поставщик</title>
+		<style>
+			body {font-family: sans-serif; font-size: 10pt;}
+			h1 {font-size: 15pt;}
+			h2 {font-size: 12pt; margin-top: 25px;}
+			table {border-collapse: collapse; margin: 10px 0px;}
+			td, th {border: 1px solid #ccc; padding: 3px 8px; text-align: left;}
+			form {display: inline; margin-right: 5px;}
+			a {color: #000;}
+			a:hover {background-color: #444; color: #fff;}
+			s {color: #f00; text-decoration: none;}
+			b {color: #999;}
+			nav a {margin-right: 10px;}
+		</style>
+	</head>
+	<body>
+		<h1>Внимательный Поставщик</h1>
+		<nav>
+			<a href="{{.Links.Searches}}">Сохраненные поиски</a>
+			<a href="{{.Links.Search}}">Поиск по архиву</a>
+			<a href="{{.Links.Diagnostics}}">Диагностика</a>
+			<a href="{{.Links.Generate}}">Генератор ссылок</a>
+			<a href="{{.Links.Decode}}">Расшифровка ссылок</a>
+			<a href="{{.Links.Docs}}">Инструкция</a>
+		</nav>
+		{{if .Message}}
+			<div><s>{{.Message}}</s></div>
+		{{end}}
+
+		<h2>Состояние</h2>
+		<table>
+			<tr>
+				<th>Прокси</th>
+				<td>{{if .Paused}}<s>остановлен</s>{{else}}запущен{{end}}</td>
+			</tr>
+			<tr><th>Фильтр</th><td>{{if .FilterEnabled}}включен{{else}}выключен{{end}}</td></tr>
+			<tr><th>Адрес</th><td>{{.BaseURL}}</td></tr>
+			<tr><th>Слушает</th><td>{{.Listen}}</td></tr>
+			<tr><th>Работает с</th><td>{{time .Started}}</td></tr>
+			<tr><th>Закупок в архиве</th><td>{{.Orders}}</td></tr>
+			<tr><th>Отслеживаемых закупок</th><td>{{.Stars}}</td></tr>
+			<tr><th>Недоставленных веб-хуков</th><td>{{.DeadLetters}}</td></tr>
+			<tr><th>Папка настроек</th><td>{{.Dir}}</td></tr>
+		</table>
+		<div>
+			<form method="post">
+				<input type="hidden" name="{{$.CSRF.Param}}" value="{{$.CSRF.Token}}" />
+				{{if .Paused}}
+					<input type="hidden" name="action" value="{{.Actions.Resume}}" />
+					<input type="submit" value="Запустить прокси" />
+				{{else}}
+					<input type="hidden" name="action" value="{{.Actions.Pause}}" />
+					<input type="submit" value="Остановить прокси" />
+				{{end}}
+			</form>
+			<form method="post">
+				<input type="hidden" name="{{$.CSRF.Param}}" value="{{$.CSRF.Token}}" />
+				{{if .FilterEnabled}}
+					<input type="hidden" name="action" value="{{.Actions.FilterDisable}}" />
+					<input type="submit" value="Выключить фильтр" />
+				{{else}}
+					<input type="hidden" name="action" value="{{.Actions.FilterEnable}}" />
+					<input type="submit" value="Включить фильтр" />
+				{{end}}
+			</form>
+			<form method="post">
+				<input type="hidden" name="{{$.CSRF.Param}}" value="{{$.CSRF.Token}}" />
+				<input type="hidden" name="action" value="{{.Actions.RemoveCache}}" />
+				<input type="submit" value="Сбросить кэш" />
+			</form>
+			<form method="post" onsubmit="return confirm('Завершить программу?')">
+				<input type="hidden" name="{{$.CSRF.Param}}" value="{{$.CSRF.Token}}" />
+				<input type="hidden" name="action" value="{{.Actions.Exit}}" />
+				<input type="submit" value="Выход" />
+			</form>
+		</div>
+
+		<h2>Ленты</h2>
+		{{if .Feeds}}
+			<table>
+				<tr>
+					<th>Название</th>
+					<th>Последний опрос</th>
+					<th>Последний успешный</th>
+					<th>Следующий</th>
+					<th>Закупок в ленте</th>
+					<th>Ошибок разбора</th>
+					<th>Удалено фильтром</th>
+					<th>Ошибка опроса</th>
+				</tr>
+				{{range .Feeds}}
+					<tr>
+						<td><a href="{{.FeedLink}}">{{.Name}}</a></td>
+						<td>{{time .State.LastPoll}}</td>
+						<td>{{time .State.LastSuccess}}</td>
+						<td>{{time .State.NextPoll}}</td>
+						<td>{{.Orders}}</td>
+						<td>{{.Errors}}</td>
+						<td>{{printf "%.1f" .RemovedPercent}}%</td>
+						<td>{{if .State.LastError}}<s>{{.State.LastError}}</s> ({{.State.Failures}}){{end}}</td>
+					</tr>
+				{{end}}
+			</table>
+		{{else}}
+			<div>Сохраненных поисков нет</div>
+		{{end}}
+	</body>
+</html>`))
+
+// DashboardFeed contains state of saved search feed
+type DashboardFeed struct {
+	*SavedSearch
+	FeedLink       string
+	State          PollState
+	Orders         int     // count of orders in feed history
+	Errors         int     // count of parsing errors
+	RemovedPercent float64 // percent of new orders removed by filter
+}
+
+// Dashboard contains data of dashboard page
+type Dashboard struct {
+	Paused        bool
+	FilterEnabled bool
+	BaseURL       string // public url of proxy
+	Listen        string // listen address
+	Started       time.Time
+	Orders        int // count of archived orders
+	Stars         int
+	DeadLetters   int
+	CSRFToken     string // token of action forms
+	Dir           string // directory with settings
+	Feeds         []*DashboardFeed
+	Message       string
+}
+
+// Render writes html page of dashboard
+func (d *Dashboard) Render(w io.Writer) error {
+	return dashboardTmpl.Execute(w, map[string]interface{}{
+		"Paused":        d.Paused,
+		"FilterEnabled": d.FilterEnabled,
+		"BaseURL":       d.BaseURL,
+		"Listen":        d.Listen,
+		"Started":       d.Started,
+		"Orders":        d.Orders,
+		"Stars":         d.Stars,
+		"DeadLetters":   d.DeadLetters,
+		"Dir":           d.Dir,
+		"Feeds":         d.Feeds,
+		"Message":       d.Message,
+		"CSRF": map[string]string{
+			"Param": _DASHBOARD_CSRF_PARAM,
+			"Token": d.CSRFToken,
+		},
+		"Links": map[string]string{
+			"Searches":    d.BaseURL + _PATH_TO_SEARCHES,
+			"Search":      d.BaseURL + _PATH_TO_SEARCH,
+			"Diagnostics": d.BaseURL + _PATH_TO_DIAGNOSTICS,
+			"Docs":        d.BaseURL + _PATH_TO_DOCS + "/",
+			"Generate":    d.BaseURL + _PATH_TO_GENERATE,
+			"Decode":      d.BaseURL + _PATH_TO_DECODE,
+		},
+		"Actions": map[string]string{
+			"Resume":        _DASHBOARD_ACTION_RESUME,
+			"Pause":         _DASHBOARD_ACTION_PAUSE,
+			"FilterEnable":  _DASHBOARD_ACTION_FILTER_ENABLE,
+			"FilterDisable": _DASHBOARD_ACTION_FILTER_DISABLE,
+			"RemoveCache":   _DASHBOARD_ACTION_REMOVE_CACHE,
+			"Exit":          _DASHBOARD_ACTION_EXIT,
+		},
+	})
+}
+
+// NewCSRFToken returns random token of dashboard forms
+func NewCSRFToken() string {
+	token := make([]byte, _DASHBOARD_CSRF_LENGTH)
+	if _, err := rand.Read(token); err != nil {
+		panic("NewCSRFToken(): " + err.Error())
+	}
+	return hex.EncodeToString(token)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Names of laws in param placeOfSearch
+var searchLaws = map[string]string{
+	"FZ_44":     "44-ФЗ",
+	"FZ_223":    "223-ФЗ",
+	"FZ_94":     "94-ФЗ",
+	"PP_RF_615": "ПП РФ 615",
+}
+
+// Names of order stages in param orderStages
+var searchStages = map[string]string{
+	"AF": "Подача заявок",
+	"CA": "Работа комиссии",
+	"PC": "Закупка завершена",
+	"PA": "Закупка отменена",
+}
+
+// SearchParam is search parameter of zakupki.gov.ru in readable form
+type SearchParam struct {
+	Name  string
+	Value string
+}
+
+// DecodedSearch describes what search url searches for. Problems
+// contains reasons why feed of url may work incorrectly
+type DecodedSearch struct {
+	URL      string // url of csv stream or search page
+	Params   []*SearchParam
+	Problems []string
+}
+
+// DecodeSearchURL decodes feed link /rss?url=, url of csv stream or url
+// of search page
+func DecodeSearchURL(rawurl string) (*DecodedSearch, error) {
+	URL, err := url.Parse(strings.TrimSpace(rawurl))
+	if err != nil {
+		return nil, err
+	}
+	// link may contain path prefix of proxy
+	if strings.HasSuffix(URL.Path, _PATH_TO_RSS) {
+		if URL, err = url.Parse(URL.Query().Get("url")); err != nil {
+			return nil, err
+		}
+	}
+	if !URL.IsAbs() {
+		return nil, errors.New("Passed url isn't absolute")
+	}
+	if URL.Host != _URL_REQUIRED_HOST &&
+		URL.Host != _URL_REQUIRED_ALIAS_HOST {
+		return nil, errors.New("Invalid url host")
+	}
+
+	decoded := &DecodedSearch{URL: URL.String()}
+	add := func(name string, values ...string) {
+		var value []string
+		for _, v := range values {
+			if v = strings.TrimSpace(v); len(v) > 0 {
+				value = append(value, v)
+			}
+		}
+		if len(value) > 0 {
+			decoded.Params = append(decoded.Params,
+				&SearchParam{name, strings.Join(value, ", ")})
+		}
+	}
+	names := func(codes []string, dict map[string]string) []string {
+		result := make([]string, len(codes))
+		for i, code := range codes {
+			if name, ok := dict[code]; ok {
+				result[i] = name
+			} else {
+				result[i] = code
+			}
+		}
+		return result
+	}
+	between := func(from, to, unit string) string {
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		switch {
+		case len(from) > 0 && len(to) > 0:
+			return "от " + from + " до " + to + unit
+		case len(from) > 0:
+			return "от " + from + unit
+		case len(to) > 0:
+			return "до " + to + unit
+		}
+		return ""
+	}
+
+	vals := URL.Query()
+	add("Строка поиска", vals.Get("searchString"))
+	if vals.Get("morphology") == "true" {
+		add("Морфология", "учитывается")
+	}
+	if vals.Get("strictEqual") == "true" {
+		add("Точное совпадение", "да")
+	}
+	add("Законы", names(vals["placeOfSearch"], searchLaws)...)
+	add("Начальная цена", between(vals.Get("priceFrom"),
+		vals.Get("priceTo"), " руб."))
+	add("Этапы", names(vals["orderStages"], searchStages)...)
+	add("Заказчик", vals.Get("customerTitle"))
+	add("Регионы", vals["regions"]...)
+	add("Дата размещения", between(vals.Get("publishDateFrom"),
+		vals.Get("publishDateTo"), ""))
+	add("Дата обновления", between(vals.Get("updateDateFrom"),
+		vals.Get("updateDateTo"), ""))
+
+	problem := func(text string) {
+		decoded.Problems = append(decoded.Problems, text)
+	}
+	if URL.Scheme != _URL_REQUIRED_SCHEME {
+		problem("Схема ссылки " + URL.Scheme + ", требуется " +
+			_URL_REQUIRED_SCHEME)
+	}
+	if URL.Host != _URL_REQUIRED_HOST {
+		problem("Хост ссылки " + URL.Host + ", прокси загружает " +
+			"закупки с " + _URL_REQUIRED_HOST)
+	}
+	switch URL.Path {
+	case _URL_REQUIRED_QUICK_SEARCH_PATH:
+		if vals.Get("quickSearch") != "true" {
+			problem("Для быстрого поиска требуется quickSearch=true, " +
+				"прокси исправит параметр при загрузке")
+		}
+	case _URL_REQUIRED_EXTENDED_SEARCH_PATH:
+		if vals.Get("quickSearch") != "false" {
+			problem("Для расширенного поиска требуется " +
+				"quickSearch=false, прокси исправит параметр при загрузке")
+		}
+	default:
+		if _, ok := SearchPaths[URL.Path]; ok {
+			problem("Ссылка ведет на страницу поиска, прокси загрузит " +
+				"выгрузку закупок этого поиска в csv")
+		} else {
+			problem("Неизвестный путь ссылки " + URL.Path)
+		}
+	}
+	if sortBy := vals.Get("sortBy"); sortBy != _URL_REQUIRED_SORTING_TYPE {
+		problem("Закупки отсортированы не по дате размещения (sortBy=" +
+			sortBy + "), прокси исправит сортировку при загрузке")
+	}
+	if dir := vals.Get("sortDirection"); dir != _URL_REQUIRED_SORTING_DIRECTION {
+		problem("Закупки отсортированы не по убыванию (sortDirection=" +
+			dir + "), прокси исправит сортировку при загрузке")
+	}
+	if vals.Get("conf") != _URL_CSV_COLUMNS {
+		problem("В выгрузку включены не все колонки (conf), прокси " +
+			"включит все колонки при загрузке")
+	}
+
+	return decoded, nil
+}
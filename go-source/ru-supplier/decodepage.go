@@ -0,0 +1,61 @@
+package main
+
+import (
+	"html/template"
+	"io"
+)
+
+var decodeTmpl = template.Must(template.New("decode").Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="utf-8" />
+		<title>Расшифровка ссылки</title>
+		<style>
+			body {font-family: sans-serif; font-size: 10pt;}
+			h1 {font-size: 15pt;}
+			form div {margin: 5px 0px;}
+			textarea {width: 100%; max-width: 800px;}
+			table {border-collapse: collapse; margin: 10px 0px;}
+			td, th {border: 1px solid #ccc; padding: 3px 8px; text-align: left;}
+			s {color: #f00; text-decoration: none;}
+		</style>
+	</head>
+	<body>
+		<h1>Расшифровка ссылки</h1>
+		<form method="get">
+			<div>Ссылка на ленту или на выгрузку закупок:</div>
+			<div><textarea name="url" rows="5">{{.URL}}</textarea></div>
+			<div><input type="submit" value="Расшифровать" /></div>
+		</form>
+		{{if .Error}}
+			<div><s>{{.Error}}</s></div>
+		{{end}}
+		{{with .Decoded}}
+			{{if .Params}}
+				<table>
+					{{range .Params}}
+						<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+					{{end}}
+				</table>
+			{{else}}
+				<div>Параметры поиска не заданы</div>
+			{{end}}
+			{{range .Problems}}
+				<div><s>{{.}}</s></div>
+			{{end}}
+		{{end}}
+	</body>
+</html>`))
+
+// WriteDecodePage writes html page of link decoder
+func WriteDecodePage(w io.Writer, rawurl string, decoded *DecodedSearch,
+	err error) error {
+	data := map[string]interface{}{
+		"URL":     rawurl,
+		"Decoded": decoded,
+	}
+	if err != nil {
+		data["Error"] = err.Error()
+	}
+	return decodeTmpl.Execute(w, data)
+}
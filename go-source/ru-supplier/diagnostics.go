@@ -0,0 +1,266 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Count of last failing rows which are kept for each feed
+const _DIAGNOSTICS_ROWS_LIMIT = 20
+
+// Max count of feeds with diagnostics, diagnostics of the least
+// recently updated feed are removed when limit is exceeded
+const _DIAGNOSTICS_FEEDS_LIMIT = 100
+
+var diagnosticsTmpl = template.Must(template.New("diagnostics").Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="utf-8" />
+		<title>Диагностика</title>
+		<style>
+			body {font-family: sans-serif; font-size: 10pt;}
+			h1 {font-size: 15pt;}
+			h2 {font-size: 12pt; margin-top: 25px;}
+			table {border-collapse: collapse; margin: 10px 0px;}
+			td, th {border: 1px solid #ccc; padding: 3px 8px; text-align: left;}
+			pre {white-space: pre-wrap; margin: 0px;}
+			s {color: #f00; text-decoration: none;}
+			b {color: #999;}
+		</style>
+	</head>
+	<body>
+		<h1>Диагностика разбора закупок</h1>
+		{{range .}}
+			<h2>{{if .Title}}{{.Title}}{{else}}{{.URL}}{{end}}</h2>
+			<div><b>Обновлено:</b> {{.Updated.Format "02.01.2006 15:04:05"}}</div>
+			<table>
+				<tr><th>Разобрано строк</th><td>{{.Rows}}</td></tr>
+				<tr><th>Строк с ошибками разбора</th><td>{{.FailedRows}}</td></tr>
+				<tr><th>Ошибок в полях</th><td>{{.FieldErrors}}</td></tr>
+				<tr><th>Новых закупок проверено фильтром</th><td>{{.Filtered}}</td></tr>
+				<tr><th>Удалено фильтром</th><td>{{.Removed}} ({{printf "%.1f" .RemovedPercent}}%)</td></tr>
+			</table>
+			{{if .Fields}}
+				<table>
+					{{range $msg, $count := .Fields}}
+						<tr><td>{{$msg}}</td><td>{{$count}}</td></tr>
+					{{end}}
+				</table>
+			{{end}}
+			{{if .LastFailures}}
+				<table>
+					<tr><th>Время</th><th>Ошибка</th><th>Строка</th></tr>
+					{{range .LastFailures}}
+						<tr>
+							<td>{{.Time.Format "02.01.2006 15:04:05"}}</td>
+							<td><s>{{.Error}}</s></td>
+							<td><pre>{{.Row}}</pre></td>
+						</tr>
+					{{end}}
+				</table>
+			{{end}}
+		{{else}}
+			<div>Ленты еще не загружались</div>
+		{{end}}
+	</body>
+</html>`))
+
+// FailedRow is raw csv row which was not parsed or was parsed with
+// errors in fields
+type FailedRow struct {
+	Time  time.Time
+	Row   string
+	Error string
+}
+
+// FeedDiagnostics contains parsing statistic of one feed
+type FeedDiagnostics struct {
+	URL          string
+	Title        string         // search string of feed
+	Updated      time.Time      // time of last parsed row
+	Rows         int            // count of successfully parsed rows
+	FailedRows   int            // count of rows which were not parsed
+	FieldErrors  int            // count of errors in fields
+	Fields       map[string]int // field error counts by error message
+	LastFailures []*FailedRow   // last failing rows, newest first
+	Filtered     int            // count of new orders passed to filter
+	Removed      int            // count of orders removed by filter
+}
+
+// Errors returns count of failed rows and field errors
+func (fd *FeedDiagnostics) Errors() int {
+	return fd.FailedRows + fd.FieldErrors
+}
+
+// RemovedPercent returns percent of orders removed by filter
+func (fd *FeedDiagnostics) RemovedPercent() float64 {
+	if fd.Filtered == 0 {
+		return 0
+	}
+	return float64(fd.Removed) * 100 / float64(fd.Filtered)
+}
+
+// Diagnostics aggregates parsing errors for each feed
+type Diagnostics struct {
+	mutex sync.Mutex
+	feeds map[string]*FeedDiagnostics
+	limit int // max count of kept failing rows for each feed
+}
+
+func NewDiagnostics(limit int) *Diagnostics {
+	if limit < 0 {
+		panic("NewDiagnostics(): passed negative limit")
+	}
+	return &Diagnostics{
+		feeds: make(map[string]*FeedDiagnostics),
+		limit: limit,
+	}
+}
+
+// feed returns diagnostics of feed with url rawurl. Mutex must be
+// locked
+func (d *Diagnostics) feed(rawurl string) *FeedDiagnostics {
+	fd, ok := d.feeds[rawurl]
+	if !ok {
+		if len(d.feeds) >= _DIAGNOSTICS_FEEDS_LIMIT {
+			d.evict()
+		}
+		fd = &FeedDiagnostics{
+			URL:    rawurl,
+			Fields: make(map[string]int),
+		}
+		if URL, err := url.Parse(rawurl); err == nil {
+			fd.Title = URL.Query().Get("searchString")
+		}
+		d.feeds[rawurl] = fd
+	}
+	fd.Updated = time.Now()
+	return fd
+}
+
+// evict removes diagnostics of the least recently updated feed. Mutex
+// must be locked
+func (d *Diagnostics) evict() {
+	var oldest *FeedDiagnostics
+	for _, fd := range d.feeds {
+		if oldest == nil || fd.Updated.Before(oldest.Updated) {
+			oldest = fd
+		}
+	}
+	if oldest != nil {
+		delete(d.feeds, oldest.URL)
+	}
+}
+
+// pushFailure saves failing row. Mutex must be locked
+func (d *Diagnostics) pushFailure(fd *FeedDiagnostics, row []byte,
+	msg string) {
+	if d.limit == 0 {
+		return
+	}
+	fd.LastFailures = append([]*FailedRow{{
+		time.Now(),
+		strings.TrimRight(string(row), "\r\n"),
+		msg,
+	}}, fd.LastFailures...)
+	if len(fd.LastFailures) > d.limit {
+		fd.LastFailures = fd.LastFailures[:d.limit]
+	}
+}
+
+// RowParsed registers parsed order and errors in its fields
+func (d *Diagnostics) RowParsed(rawurl string, row []byte, order *Order) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	fd := d.feed(rawurl)
+	fd.Rows++
+	if len(order.Errors) > 0 {
+		msgs := make([]string, len(order.Errors))
+		for i, err := range order.Errors {
+			msgs[i] = err.Error()
+			fd.FieldErrors++
+			// group errors by description without details
+			fd.Fields[strings.SplitN(msgs[i], ":", 2)[0]]++
+		}
+		d.pushFailure(fd, row, strings.Join(msgs, "; "))
+	}
+}
+
+// RowFailed registers row which was not parsed
+func (d *Diagnostics) RowFailed(rawurl string, row []byte, err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	fd := d.feed(rawurl)
+	fd.FailedRows++
+	d.pushFailure(fd, row, err.Error())
+}
+
+// OrdersFiltered registers count of new orders of feed which were
+// passed to filter and count of removed orders
+func (d *Diagnostics) OrdersFiltered(rawurl string, total, removed int) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	fd := d.feed(rawurl)
+	fd.Filtered += total
+	fd.Removed += removed
+}
+
+// Feed returns copy of diagnostics of feed with url rawurl or nil
+func (d *Diagnostics) Feed(rawurl string) *FeedDiagnostics {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	fd, ok := d.feeds[rawurl]
+	if !ok {
+		return nil
+	}
+	return fd.copy()
+}
+
+// copy returns deep copy of feed diagnostics. Mutex must be locked
+func (fd *FeedDiagnostics) copy() *FeedDiagnostics {
+	fdCopy := *fd
+	fdCopy.Fields = make(map[string]int, len(fd.Fields))
+	for msg, count := range fd.Fields {
+		fdCopy.Fields[msg] = count
+	}
+	fdCopy.LastFailures = append([]*FailedRow(nil), fd.LastFailures...)
+	return &fdCopy
+}
+
+// Feeds returns copy of diagnostics of all feeds sorted by title
+func (d *Diagnostics) Feeds() []*FeedDiagnostics {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	feeds := make([]*FeedDiagnostics, 0, len(d.feeds))
+	for _, fd := range d.feeds {
+		feeds = append(feeds, fd.copy())
+	}
+	sort.Sort(feedDiagnosticsByTitle(feeds))
+	return feeds
+}
+
+// Render writes html page with diagnostics of all feeds
+func (d *Diagnostics) Render(w io.Writer) error {
+	return diagnosticsTmpl.Execute(w, d.Feeds())
+}
+
+type feedDiagnosticsByTitle []*FeedDiagnostics
+
+func (s feedDiagnosticsByTitle) Len() int      { return len(s) }
+func (s feedDiagnosticsByTitle) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s feedDiagnosticsByTitle) Less(i, j int) bool {
+	if s[i].Title == s[j].Title {
+		return s[i].URL < s[j].URL
+	}
+	return s[i].Title < s[j].Title
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"html/template"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Digest schedules
+const (
+	_DIGEST_IMMEDIATE = "immediate"
+	_DIGEST_HOURLY    = "hourly"
+	_DIGEST_DAILY     = "daily"
+)
+
+// period of checking which digests must be sent
+const _DIGEST_TICK = time.Minute
+
+const (
+	// delay before sending of failed digest again, it grows twice
+	// with each failure
+	_DIGEST_RETRY_DELAY = 5 * time.Minute
+	// max delay before sending of failed digest again
+	_DIGEST_RETRY_MAX_DELAY = 6 * time.Hour
+)
+
+// digestTmpl contains order descriptions of rss feed
+var digestTmpl = template.Must(template.Must(tmpl.Clone()).New("digest").
+	Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="utf-8" />
+		<title>{{.Title}}</title>
+		{{template "style"}}
+	</head>
+	<body>
+		<h1>{{.Title}}</h1>
+		{{range .Orders}}
+			<hr />
+			{{template "order" .}}
+		{{end}}
+	</body>
+</html>`))
+
+// DigestConfig describes email digest of saved search with slug
+// Search. Immediate digest is sent after each poll with new orders,
+// hourly digest is sent at the beginning of each hour, daily digest is
+// sent at Hour o'clock
+type DigestConfig struct {
+	Search   string
+	To       []string
+	Schedule string
+	Hour     int `json:",omitempty"`
+}
+
+// Verify checks digest fields
+func (d *DigestConfig) Verify() error {
+	if !slugExp.MatchString(d.Search) {
+		return errors.New("Digest: invalid saved search slug")
+	}
+	if len(d.To) == 0 {
+		return errors.New("Digest: no recipients")
+	}
+	switch d.Schedule {
+	case _DIGEST_IMMEDIATE, _DIGEST_HOURLY, _DIGEST_DAILY:
+	default:
+		return errors.New("Digest: invalid schedule " + d.Schedule)
+	}
+	if d.Hour < 0 || d.Hour > 23 {
+		return errors.New("Digest: invalid hour")
+	}
+	return nil
+}
+
+// subscriber returns identity of digest in feed delivery cursors
+func (d *DigestConfig) subscriber() string {
+	return "email:" + d.Search + ":" + strings.Join(d.To, ",")
+}
+
+// slot returns beginning of current digest period
+func (d *DigestConfig) slot(now time.Time) time.Time {
+	switch d.Schedule {
+	case _DIGEST_HOURLY:
+		return now.Truncate(time.Hour)
+	case _DIGEST_DAILY:
+		slot := time.Date(now.Year(), now.Month(), now.Day(), d.Hour, 0, 0,
+			0, now.Location())
+		if now.Before(slot) {
+			slot = slot.AddDate(0, 0, -1)
+		}
+		return slot
+	}
+	return now
+}
+
+// MakeDigest makes html document with descriptions of orders
+func MakeDigest(title string, orders []*Order) (string, error) {
+	data := make([]map[string]interface{}, len(orders))
+	for i, order := range orders {
+		data[i] = descriptionData(order, nil, "")
+	}
+	buff := bytes.NewBuffer(nil)
+	err := digestTmpl.Execute(buff, map[string]interface{}{
+		"Title":  title,
+		"Orders": data,
+	})
+	return buff.String(), err
+}
+
+// Digests sends new orders of saved searches by email. Digest keeps
+// delivery cursor in feed history, so orders are not lost when server
+// is restarted or mail is not sent
+type Digests struct {
+	configs  []*DigestConfig
+	mailer   *Mailer
+	archive  *Archive
+	searches *Searches
+	filter   func(rawurl string, items []*FeedItem) []*FeedItem
+	trigger  chan string // slugs of polled saved searches
+
+	mutex sync.Mutex
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewDigests creates digests which filter orders with filter. Mailer
+// may be nil if there are no digests
+func NewDigests(configs []*DigestConfig, mailer *Mailer, archive *Archive,
+	searches *Searches,
+	filter func(string, []*FeedItem) []*FeedItem) *Digests {
+	if mailer == nil && len(configs) > 0 {
+		panic("NewDigests(): passed nil mailer")
+	}
+	if archive == nil || searches == nil || filter == nil {
+		panic("NewDigests(): passed nil archive, searches or filter")
+	}
+	d := &Digests{
+		mailer:   mailer,
+		archive:  archive,
+		searches: searches,
+		filter:   filter,
+		trigger:  make(chan string, _EVENTS_QUEUE_SIZE),
+	}
+	for _, config := range configs {
+		if err := config.Verify(); err != nil {
+			log.Println("Skip digest:", err)
+			continue
+		}
+		d.configs = append(d.configs, config)
+	}
+	return d
+}
+
+// Start starts sending of digests in background
+func (d *Digests) Start() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	if d.stop != nil {
+		return errors.New("Digests are already running")
+	}
+	d.stop = make(chan struct{})
+	d.wg.Add(1)
+	go d.run(d.stop)
+	return nil
+}
+
+// Stop stops sending of digests
+func (d *Digests) Stop() error {
+	d.mutex.Lock()
+	if d.stop == nil {
+		d.mutex.Unlock()
+		return errors.New("Digests are already stopped")
+	}
+	close(d.stop)
+	d.stop = nil
+	d.mutex.Unlock()
+	d.wg.Wait()
+	return nil
+}
+
+// Notify triggers immediate digests of saved search
+func (d *Digests) Notify(event *FeedEvent) {
+	if event.Search == nil {
+		return
+	}
+	select {
+	case d.trigger <- event.Search.Slug:
+	default:
+	}
+}
+
+func (d *Digests) run(stop chan struct{}) {
+	defer d.wg.Done()
+
+	// digests are sent since start up, unsent orders are sent at the
+	// next period
+	last := make(map[*DigestConfig]time.Time)
+	// failed digests are sent again after delay
+	retry := make(map[*DigestConfig]time.Time)
+	delay := make(map[*DigestConfig]time.Duration)
+	now := time.Now()
+	for _, config := range d.configs {
+		last[config] = now
+		ss, err := d.searches.Get(config.Search)
+		if err != nil {
+			log.Println("Digest:", config.Search, err)
+			continue
+		}
+		err = d.archive.InitCursor(ss.URL, config.subscriber())
+		if err != nil {
+			log.Println("Digest:", err)
+		}
+	}
+
+	send := func(config *DigestConfig) {
+		if err := d.send(config); err != nil {
+			log.Println("Can't send digest:", err)
+			if delay[config] *= 2; delay[config] == 0 {
+				delay[config] = _DIGEST_RETRY_DELAY
+			} else if delay[config] > _DIGEST_RETRY_MAX_DELAY {
+				delay[config] = _DIGEST_RETRY_MAX_DELAY
+			}
+			retry[config] = time.Now().Add(delay[config])
+		} else {
+			delete(retry, config)
+			delete(delay, config)
+			last[config] = time.Now()
+		}
+	}
+
+	ticker := time.NewTicker(_DIGEST_TICK)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case slug := <-d.trigger:
+			for _, config := range d.configs {
+				_, failed := retry[config]
+				if !failed && config.Search == slug &&
+					config.Schedule == _DIGEST_IMMEDIATE {
+					send(config)
+				}
+			}
+		case now := <-ticker.C:
+			for _, config := range d.configs {
+				if at, failed := retry[config]; failed {
+					if !now.Before(at) {
+						send(config)
+					}
+				} else if config.Schedule != _DIGEST_IMMEDIATE &&
+					config.slot(now).After(last[config]) {
+					send(config)
+				}
+			}
+		}
+	}
+}
+
+// send sends orders of saved search which were not sent yet. Cursor
+// is moved past sent orders, so orders are sent once
+func (d *Digests) send(config *DigestConfig) error {
+	ss, err := d.searches.Get(config.Search)
+	if err != nil {
+		return err
+	}
+	subscriber := config.subscriber()
+	seq, err := d.archive.Cursor(ss.URL, subscriber)
+	if err != nil {
+		return err
+	}
+
+	var items []*FeedItem
+	for {
+		page, err := d.archive.ItemsSince(FeedID(ss.URL), seq,
+			_FEED_DELIVERY_LIMIT)
+		if err != nil {
+			return err
+		}
+		if len(page) > 0 {
+			items = append(items, page...)
+			seq = page[len(page)-1].Seq
+		}
+		if len(page) < _FEED_DELIVERY_LIMIT {
+			break
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	// digest lists the newest orders first
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+
+	if items = d.filter(ss.URL, items); len(items) > 0 {
+		title := ss.Name + ": новые закупки (" + strconv.Itoa(len(items)) +
+			")"
+		html, err := MakeDigest(title, ItemsToOrders(items))
+		if err != nil {
+			return err
+		}
+		if err = d.mailer.Send(config.To, title, html); err != nil {
+			return err
+		}
+		LogInfof("Digest of %q was sent to %s\n", ss.Name,
+			strings.Join(config.To, ", "))
+	}
+
+	return d.archive.SetCursor(ss.URL, subscriber, seq)
+}
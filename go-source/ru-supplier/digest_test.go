@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// smtpServer is mail server stand-in which accepts all mails
+type smtpServer struct {
+	listener net.Listener
+	mails    chan string // subjects of received mails
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{listener, make(chan string, 100)}
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+func (s *smtpServer) serveConn(conn net.Conn) {
+	tc := textproto.NewConn(conn)
+	defer tc.Close()
+	tc.PrintfLine("220 localhost")
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(strings.Fields(line + " ")[0]); cmd {
+		case "DATA":
+			tc.PrintfLine("354 go ahead")
+			header, err := textproto.NewReader(bufio.NewReader(
+				tc.DotReader())).ReadMIMEHeader()
+			if err != nil {
+				return
+			}
+			subject, _ := new(mime.WordDecoder).DecodeHeader(
+				header.Get("Subject"))
+			s.mails <- subject
+			tc.PrintfLine("250 OK")
+		case "QUIT":
+			tc.PrintfLine("221 bye")
+			return
+		default:
+			tc.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (s *smtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+// received returns subjects of received mails
+func (s *smtpServer) received() (subjects []string) {
+	for {
+		select {
+		case subject := <-s.mails:
+			subjects = append(subjects, subject)
+		default:
+			return
+		}
+	}
+}
+
+// newTestDigests makes digests of saved search with archived orders
+// which are filtered by filter
+func newTestDigests(t *testing.T, dir string, port int,
+	filter func(string, []*FeedItem) []*FeedItem) (*Digests,
+	*DigestConfig, *SavedSearch) {
+	archive, err := OpenArchive(filepath.Join(dir, "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	searches, err := LoadSearches(filepath.Join(dir, "searches.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss := &SavedSearch{
+		Name: "Поиск",
+		URL:  "http://zakupki.gov.ru/epz/order/quicksearch/search.html?searchString=test",
+	}
+	if err = searches.Add(ss); err != nil {
+		t.Fatal(err)
+	}
+	config := &DigestConfig{
+		Search:   ss.Slug,
+		To:       []string{"user@localhost"},
+		Schedule: _DIGEST_HOURLY,
+	}
+	mailer := NewMailer(&SMTPConfig{
+		Host: "127.0.0.1",
+		Port: port,
+		From: "proxy@localhost",
+	})
+	digests := NewDigests([]*DigestConfig{config}, mailer, archive,
+		searches, filter)
+	return digests, config, ss
+}
+
+// storeTestOrders appends count new orders into feed history
+func storeTestOrders(t *testing.T, archive *Archive, rawurl string,
+	first, count int) {
+	var orders []*Order
+	for i := first + count - 1; i >= first; i-- {
+		orders = append(orders, &Order{OrderId: strconv.Itoa(i)})
+	}
+	if _, err := archive.StoreFeed(rawurl, orders); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDigestCursor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "digest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := newSMTPServer(t)
+	defer server.listener.Close()
+
+	digests, config, ss := newTestDigests(t, dir, server.port(),
+		func(rawurl string, items []*FeedItem) []*FeedItem {
+			return items
+		})
+	defer digests.archive.Close()
+
+	// more orders than one page of feed history
+	count := _FEED_DELIVERY_LIMIT + 50
+	storeTestOrders(t, digests.archive, ss.URL, 0, count)
+	if err = digests.send(config); err != nil {
+		t.Fatal(err)
+	}
+	subjects := server.received()
+	if len(subjects) != 1 {
+		t.Fatalf("%d mails, expected 1", len(subjects))
+	}
+	if !strings.Contains(subjects[0], "("+strconv.Itoa(count)+")") {
+		t.Errorf("subject %q, expected %d orders", subjects[0], count)
+	}
+
+	// all orders are sent, digest without orders isn't sent
+	if err = digests.send(config); err != nil {
+		t.Fatal(err)
+	}
+	if subjects = server.received(); len(subjects) != 0 {
+		t.Fatalf("%d mails without new orders", len(subjects))
+	}
+
+	storeTestOrders(t, digests.archive, ss.URL, count, 3)
+	if err = digests.send(config); err != nil {
+		t.Fatal(err)
+	}
+	subjects = server.received()
+	if len(subjects) != 1 || !strings.Contains(subjects[0], "(3)") {
+		t.Fatalf("mails %q, expected one mail with 3 orders", subjects)
+	}
+}
+
+func TestDigestFilteredOut(t *testing.T) {
+	dir, err := ioutil.TempDir("", "digest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	server := newSMTPServer(t)
+	defer server.listener.Close()
+
+	var filtered int
+	digests, config, ss := newTestDigests(t, dir, server.port(),
+		func(rawurl string, items []*FeedItem) []*FeedItem {
+			filtered += len(items)
+			return nil
+		})
+	defer digests.archive.Close()
+
+	storeTestOrders(t, digests.archive, ss.URL, 0, 5)
+	if err = digests.send(config); err != nil {
+		t.Fatal(err)
+	}
+	if subjects := server.received(); len(subjects) != 0 {
+		t.Fatalf("%d mails with filtered orders", len(subjects))
+	}
+
+	// filtered orders are passed once
+	if err = digests.send(config); err != nil {
+		t.Fatal(err)
+	}
+	if filtered != 5 {
+		t.Errorf("%d orders were filtered, expected 5", filtered)
+	}
+}
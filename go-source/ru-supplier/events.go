@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// size of event queue of each subscriber
+	_EVENTS_QUEUE_SIZE = 100
+	// max count of events which are sent again after reconnection
+	_EVENTS_REPLAY_LIMIT = 500
+	// period of comments which keep connection alive
+	_EVENTS_KEEP_ALIVE = 30 * time.Second
+	// event type of star alerts
+	_EVENTS_ALERT_TYPE = "alert"
+)
+
+// OrderEvent is new order which is pushed into event stream. Seq is
+// used as event id. Alerts of starred orders have no id and are sent
+// as events of type alert
+type OrderEvent struct {
+	Seq    uint64         `json:",omitempty"`
+	Feed   string         `json:",omitempty"` // feed id
+	Search string         `json:",omitempty"` // saved search slug
+	Order  *ArchiveRecord `json:",omitempty"`
+	Alert  *StarAlert     `json:",omitempty"`
+}
+
+// Render writes event in server-sent events format
+func (e *OrderEvent) Render(w io.Writer) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if e.Alert != nil {
+		_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n",
+			_EVENTS_ALERT_TYPE, data)
+	} else {
+		_, err = fmt.Fprintf(w, "id: %d\ndata: %s\n\n", e.Seq, data)
+	}
+	return err
+}
+
+// EventSubscription receives events of one feed or of all feeds if
+// feed id is empty
+type EventSubscription struct {
+	feedID string
+	events chan *OrderEvent
+}
+
+// Events returns channel of events. Channel is closed when
+// subscription is cancelled by hub
+func (sub *EventSubscription) Events() <-chan *OrderEvent {
+	return sub.events
+}
+
+// EventHub pushes new orders to event stream subscribers
+type EventHub struct {
+	mutex sync.Mutex
+	subs  map[*EventSubscription]bool
+}
+
+func NewEventHub() *EventHub {
+	return &EventHub{subs: make(map[*EventSubscription]bool)}
+}
+
+// Subscribe subscribes on events of feed with id feedID or on events
+// of all feeds if feedID is empty
+func (h *EventHub) Subscribe(feedID string) *EventSubscription {
+	sub := &EventSubscription{
+		feedID: feedID,
+		events: make(chan *OrderEvent, _EVENTS_QUEUE_SIZE),
+	}
+	h.mutex.Lock()
+	h.subs[sub] = true
+	h.mutex.Unlock()
+	return sub
+}
+
+// Unsubscribe cancels subscription
+func (h *EventHub) Unsubscribe(sub *EventSubscription) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.subs[sub] {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Disconnect cancels all subscriptions, so event streams are finished
+func (h *EventHub) Disconnect() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+// Notify sends events with new orders to subscribers. Events are
+// dropped for subscribers which do not read them
+func (h *EventHub) Notify(event *FeedEvent) {
+	feedID := FeedID(event.URL)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for sub := range h.subs {
+		if len(sub.feedID) > 0 && sub.feedID != feedID {
+			continue
+		}
+		for _, item := range event.Items {
+			select {
+			case sub.events <- &OrderEvent{
+				item.Seq, feedID, event.Slug(), item.ArchiveRecord, nil,
+			}:
+			default:
+				log.Println("Event queue is full, event dropped:",
+					item.Seq)
+			}
+		}
+	}
+}
+
+// Alert sends alert of starred order to all subscribers
+func (h *EventHub) Alert(alert *StarAlert) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for sub := range h.subs {
+		select {
+		case sub.events <- &OrderEvent{Alert: alert}:
+		default:
+			log.Println("Event queue is full, alert dropped")
+		}
+	}
+}
+
+type eventsBySeq []*OrderEvent
+
+func (s eventsBySeq) Len() int           { return len(s) }
+func (s eventsBySeq) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s eventsBySeq) Less(i, j int) bool { return s[i].Seq < s[j].Seq }
+
+// SortEvents sorts events from the oldest to the newest
+func SortEvents(events []*OrderEvent) {
+	sort.Sort(eventsBySeq(events))
+}
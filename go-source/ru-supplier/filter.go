@@ -2,11 +2,18 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
+	"log"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sync"
 )
 
+// Filter profile with name NAME is loaded from file filters_NAME.json
+const _FILTER_PROFILE_FILE_NAME_FORMAT = "filters_%s.json"
+
 type OrderFilter interface {
 	Execute([]*Order) ([]*Order, float32)
 }
@@ -253,3 +260,46 @@ func (f *Filter) Execute(orders []*Order) ([]*Order, float32) {
 // 		"OrganisationName": f.OrganisationName.PatternSet(),
 // 	})
 // }
+
+// FilterProfiles contains default filter and named filter profiles
+// which are loaded on first use
+type FilterProfiles struct {
+	mutex    sync.Mutex
+	def      OrderFilter
+	dir      string // directory of profile files
+	profiles map[string]OrderFilter
+}
+
+// NewFilterProfiles creates profiles which are loaded from directory dir
+func NewFilterProfiles(def OrderFilter, dir string) *FilterProfiles {
+	if def == nil {
+		panic("NewFilterProfiles(): passed nil default filter")
+	}
+	return &FilterProfiles{
+		def:      def,
+		dir:      dir,
+		profiles: make(map[string]OrderFilter),
+	}
+}
+
+// Get returns filter profile with passed name or default filter if
+// name is empty
+func (fp *FilterProfiles) Get(name string) OrderFilter {
+	if len(name) == 0 {
+		return fp.def
+	}
+
+	fp.mutex.Lock()
+	defer fp.mutex.Unlock()
+
+	if filter, ok := fp.profiles[name]; ok {
+		return filter
+	}
+	filter, err := LoadFilter(filepath.Join(fp.dir,
+		fmt.Sprintf(_FILTER_PROFILE_FILE_NAME_FORMAT, name)))
+	if err != nil {
+		log.Println("Filter profile", name+":", err)
+	}
+	fp.profiles[name] = filter
+	return filter
+}
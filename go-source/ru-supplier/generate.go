@@ -0,0 +1,117 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// ConvertSearchURL converts url of search page into url of csv stream
+// sorted by publish date. It is the same conversion as in urls tool
+func ConvertSearchURL(rawurl string) (*url.URL, error) {
+	URL, err := ParseSearchURL(strings.TrimSpace(rawurl))
+	if err != nil {
+		return nil, err
+	}
+	return NormalizeSearchURL(URL), nil
+}
+
+// FeedURL returns url of csv stream which is the key of feed in
+// fetches, cache, archive and metrics, so each search has one feed
+// whichever form of its url is passed
+func FeedURL(rawurl string) (string, error) {
+	URL, err := ConvertSearchURL(rawurl)
+	if err != nil {
+		return "", err
+	}
+	return URL.String(), nil
+}
+
+// MakeRSSLink makes link to feed of csv stream, base is public url of
+// proxy
+func MakeRSSLink(csvurl, base string) string {
+	return base + _PATH_TO_RSS + "?" + url.Values{"url": {csvurl}}.Encode()
+}
+
+// GeneratedLink is result of link generator
+type GeneratedLink struct {
+	Search string // url of search page
+	URL    string // url of csv stream
+	Feed   string // link to feed
+}
+
+// GenerateLink converts url of search page into link to feed of server
+// with public url base
+func GenerateLink(search, base string) (*GeneratedLink, error) {
+	URL, err := ConvertSearchURL(search)
+	if err != nil {
+		return nil, err
+	}
+	return &GeneratedLink{
+		Search: search,
+		URL:    URL.String(),
+		Feed:   MakeRSSLink(URL.String(), base),
+	}, nil
+}
+
+var generateTmpl = template.Must(template.New("generate").Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="utf-8" />
+		<title>Генератор ссылок</title>
+		<style>
+			body {font-family: sans-serif; font-size: 10pt;}
+			h1 {font-size: 15pt;}
+			form div {margin: 5px 0px;}
+			textarea {width: 100%; max-width: 800px;}
+			a {color: #000; word-break: break-all;}
+			a:hover {background-color: #444; color: #fff;}
+			s {color: #f00; text-decoration: none;}
+		</style>
+	</head>
+	<body>
+		<h1>Генератор ссылок</h1>
+		<form method="get">
+			<div>Ссылка на страницу с закупками:</div>
+			<div><textarea name="search" rows="5">{{.Search}}</textarea></div>
+			<div><input type="submit" value="Генерировать" /></div>
+		</form>
+		{{if .Error}}
+			<div><s>{{.Error}}</s></div>
+		{{end}}
+		{{with .Link}}
+			<div>Ссылка на ленту: <a href="{{.Feed}}">{{.Feed}}</a></div>
+			<form method="post" action="{{$.SearchesLink}}">
+				<input type="hidden" name="{{$.CSRF.Param}}" value="{{$.CSRF.Token}}" />
+				<input type="hidden" name="action" value="save" />
+				<input type="hidden" name="url" value="{{.URL}}" />
+				<div>
+					Сохранить поиск:
+					<input type="text" name="name" placeholder="Название" />
+					<input type="text" name="slug" placeholder="Короткое имя" />
+					<input type="submit" value="Сохранить" />
+				</div>
+			</form>
+		{{end}}
+	</body>
+</html>`))
+
+// WriteGeneratePage writes html page of link generator, base is public
+// url of proxy, csrf is token of form which saves search
+func WriteGeneratePage(w io.Writer, base, search string,
+	link *GeneratedLink, csrf string, err error) error {
+	data := map[string]interface{}{
+		"Search":       search,
+		"Link":         link,
+		"SearchesLink": base + _PATH_TO_SEARCHES,
+		"CSRF": map[string]string{
+			"Param": _DASHBOARD_CSRF_PARAM,
+			"Token": csrf,
+		},
+	}
+	if err != nil {
+		data["Error"] = err.Error()
+	}
+	return generateTmpl.Execute(w, data)
+}
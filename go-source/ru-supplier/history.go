@@ -0,0 +1,402 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// max count of items which are kept in history of each feed
+	_FEED_HISTORY_LIMIT = 1000
+	// max count of items which are delivered to subscriber at once
+	_FEED_DELIVERY_LIMIT = 100
+)
+
+// Sub buckets of feed bucket: items contains sequence numbers and order
+// keys, keys contains order keys and sequence numbers
+var (
+	_FEED_BUCKET_ITEMS = []byte("items")
+	_FEED_BUCKET_KEYS  = []byte("keys")
+)
+
+// Separator between feed id and subscriber in cursor key
+const _CURSOR_KEY_SEPARATOR = 0
+
+// FeedItem is archived order which was appended into feed history.
+// Seq is unique among all feeds and grows with each appended order
+type FeedItem struct {
+	Seq uint64
+	*ArchiveRecord
+}
+
+// FeedID returns id of feed with url rawurl
+func FeedID(rawurl string) string {
+	hash := md5.New()
+	io.WriteString(hash, rawurl)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func seqKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+func cursorKey(feedID, subscriber string) []byte {
+	return append(append([]byte(feedID), _CURSOR_KEY_SEPARATOR),
+		subscriber...)
+}
+
+// feedBucket returns bucket of feed history. If create is false and
+// bucket does not exist feedBucket returns nil
+func feedBucket(tx *bolt.Tx, feedID string, create bool) (
+	*bolt.Bucket, error) {
+	bFeeds := tx.Bucket(_ARCHIVE_BUCKET_FEEDS)
+	if !create {
+		return bFeeds.Bucket([]byte(feedID)), nil
+	}
+	bFeed, err := bFeeds.CreateBucketIfNotExists([]byte(feedID))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range [][]byte{_FEED_BUCKET_ITEMS, _FEED_BUCKET_KEYS} {
+		if _, err = bFeed.CreateBucketIfNotExists(name); err != nil {
+			return nil, err
+		}
+	}
+	return bFeed, nil
+}
+
+// StoreFeed saves orders in archive and appends them into history of
+// feed with url rawurl. Orders must be sorted by publish date
+// descending as they are in csv stream. Order which is already in
+// history is updated in archive, but isn't appended again. StoreFeed
+// returns appended items from the oldest to the newest
+func (a *Archive) StoreFeed(rawurl string, orders []*Order) (
+	items []*FeedItem, err error) {
+	if len(orders) == 0 {
+		return nil, nil
+	}
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		items = nil
+		records, err := storeOrders(tx, orders)
+		if err != nil {
+			return err
+		}
+
+		bFeed, err := feedBucket(tx, FeedID(rawurl), true)
+		if err != nil {
+			return err
+		}
+		bItems := bFeed.Bucket(_FEED_BUCKET_ITEMS)
+		bKeys := bFeed.Bucket(_FEED_BUCKET_KEYS)
+
+		// the oldest order gets the least sequence number
+		for i := len(orders) - 1; i >= 0; i-- {
+			key := []byte(orders[i].Key())
+			if bKeys.Get(key) != nil {
+				// order was already announced
+				continue
+			}
+			seq, err := tx.Bucket(_ARCHIVE_BUCKET_FEEDS).NextSequence()
+			if err != nil {
+				return err
+			}
+			if err = bItems.Put(seqKey(seq), key); err != nil {
+				return err
+			}
+			if err = bKeys.Put(key, seqKey(seq)); err != nil {
+				return err
+			}
+			items = append(items, &FeedItem{seq, records[i]})
+		}
+
+		// remove the oldest items over limit
+		var count int
+		c := bItems.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			count++
+		}
+		for k, v := c.First(); k != nil &&
+			count > _FEED_HISTORY_LIMIT; k, v = c.First() {
+			if err = bKeys.Delete(append([]byte(nil), v...)); err != nil {
+				return err
+			}
+			if err = c.Delete(); err != nil {
+				return err
+			}
+			count--
+		}
+
+		return nil
+	})
+	if err != nil {
+		items = nil
+	}
+	return
+}
+
+// readItems reads feed items from the newest to the oldest while
+// next returns true
+func readItems(tx *bolt.Tx, bFeed *bolt.Bucket,
+	next func(item *FeedItem) bool) error {
+	bOrders := tx.Bucket(_ARCHIVE_BUCKET_ORDERS)
+	c := bFeed.Bucket(_FEED_BUCKET_ITEMS).Cursor()
+	for k, v := c.Last(); k != nil; k, v = c.Prev() {
+		item, err := readItem(bOrders, k, v)
+		if err != nil {
+			return err
+		}
+		if item != nil && !next(item) {
+			break
+		}
+	}
+	return nil
+}
+
+// readItemsAfter reads feed items which sequence numbers are greater
+// than seq from the oldest to the newest while next returns true
+func readItemsAfter(tx *bolt.Tx, bFeed *bolt.Bucket, seq uint64,
+	next func(item *FeedItem) bool) error {
+	bOrders := tx.Bucket(_ARCHIVE_BUCKET_ORDERS)
+	c := bFeed.Bucket(_FEED_BUCKET_ITEMS).Cursor()
+	for k, v := c.Seek(seqKey(seq + 1)); k != nil; k, v = c.Next() {
+		item, err := readItem(bOrders, k, v)
+		if err != nil {
+			return err
+		}
+		if item != nil && !next(item) {
+			break
+		}
+	}
+	return nil
+}
+
+// readItem reads archived order of feed item with sequence number k
+// and order key v. It returns nil if order isn't in archive
+func readItem(bOrders *bolt.Bucket, k, v []byte) (*FeedItem, error) {
+	data := bOrders.Get(v)
+	if data == nil {
+		return nil, nil
+	}
+	item := &FeedItem{binary.BigEndian.Uint64(k), new(ArchiveRecord)}
+	if err := json.Unmarshal(data, item.ArchiveRecord); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// ItemsSince returns items of feed with id feedID which sequence
+// numbers are greater than seq. Items are sorted from the oldest to
+// the newest, at most limit items are returned
+func (a *Archive) ItemsSince(feedID string, seq uint64, limit int) (
+	items []*FeedItem, err error) {
+	err = a.db.View(func(tx *bolt.Tx) error {
+		bFeed, err := feedBucket(tx, feedID, false)
+		if err != nil || bFeed == nil {
+			return err
+		}
+		// the oldest items after seq are returned, so client can
+		// continue from the last of them
+		return readItemsAfter(tx, bFeed, seq, func(item *FeedItem) bool {
+			items = append(items, item)
+			return len(items) < limit
+		})
+	})
+	return
+}
+
+// FeedIDs returns ids of all feeds which have history
+func (a *Archive) FeedIDs() (ids []string, err error) {
+	err = a.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(_ARCHIVE_BUCKET_FEEDS).ForEach(
+			func(k, v []byte) error {
+				// sub buckets have nil values
+				if v == nil {
+					ids = append(ids, string(k))
+				}
+				return nil
+			})
+	})
+	return
+}
+
+// Deliver returns items of feed with url rawurl which were not
+// delivered to subscriber yet and moves subscriber cursor. At most
+// _FEED_DELIVERY_LIMIT of the oldest undelivered items are returned,
+// the rest is delivered next time. Items are sorted from the newest to
+// the oldest
+func (a *Archive) Deliver(rawurl, subscriber string) (
+	items []*FeedItem, err error) {
+	feedID := FeedID(rawurl)
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		items, err = pendingItems(tx, feedID, subscriber,
+			_FEED_DELIVERY_LIMIT)
+		if err != nil || len(items) == 0 {
+			return err
+		}
+
+		last := items[len(items)-1].Seq
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+		return tx.Bucket(_ARCHIVE_BUCKET_CURSORS).Put(
+			cursorKey(feedID, subscriber), seqKey(last))
+	})
+	if err != nil {
+		items = nil
+	}
+	return
+}
+
+// Pending returns at most limit of the oldest items of feed with url
+// rawurl which were not delivered to subscriber. Cursor of subscriber
+// isn't moved. Items are sorted from the oldest to the newest
+func (a *Archive) Pending(rawurl, subscriber string, limit int) (
+	items []*FeedItem, err error) {
+	err = a.db.View(func(tx *bolt.Tx) error {
+		items, err = pendingItems(tx, FeedID(rawurl), subscriber, limit)
+		return err
+	})
+	if err != nil {
+		items = nil
+	}
+	return
+}
+
+// pendingItems reads at most limit of the oldest items of feed with id
+// feedID which were not delivered to subscriber
+func pendingItems(tx *bolt.Tx, feedID, subscriber string, limit int) (
+	items []*FeedItem, err error) {
+	bFeed, err := feedBucket(tx, feedID, false)
+	if err != nil || bFeed == nil {
+		return nil, err
+	}
+
+	var cursor uint64
+	data := tx.Bucket(_ARCHIVE_BUCKET_CURSORS).Get(
+		cursorKey(feedID, subscriber))
+	if data != nil {
+		cursor = binary.BigEndian.Uint64(data)
+	}
+
+	err = readItemsAfter(tx, bFeed, cursor, func(item *FeedItem) bool {
+		items = append(items, item)
+		return len(items) < limit
+	})
+	return
+}
+
+// Cursor returns sequence number of the last item of feed with url
+// rawurl which was delivered to subscriber
+func (a *Archive) Cursor(rawurl, subscriber string) (seq uint64,
+	err error) {
+	err = a.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(_ARCHIVE_BUCKET_CURSORS).Get(
+			cursorKey(FeedID(rawurl), subscriber))
+		if data != nil {
+			seq = binary.BigEndian.Uint64(data)
+		}
+		return nil
+	})
+	return
+}
+
+// SetCursor marks items of feed with url rawurl up to seq as delivered
+// to subscriber
+func (a *Archive) SetCursor(rawurl, subscriber string, seq uint64) error {
+	return a.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(_ARCHIVE_BUCKET_CURSORS).Put(
+			cursorKey(FeedID(rawurl), subscriber), seqKey(seq))
+	})
+}
+
+// InitCursor marks all items of feed with url rawurl as delivered to
+// subscriber if subscriber has no cursor yet, so new subscriber
+// doesn't receive old orders
+func (a *Archive) InitCursor(rawurl, subscriber string) error {
+	feedID := FeedID(rawurl)
+	return a.db.Update(func(tx *bolt.Tx) error {
+		bCursors := tx.Bucket(_ARCHIVE_BUCKET_CURSORS)
+		key := cursorKey(feedID, subscriber)
+		if bCursors.Get(key) != nil {
+			return nil
+		}
+		var seq uint64
+		bFeed, err := feedBucket(tx, feedID, false)
+		if err != nil {
+			return err
+		}
+		if bFeed != nil {
+			if k, _ := bFeed.Bucket(_FEED_BUCKET_ITEMS).Cursor().Last(); k != nil {
+				seq = binary.BigEndian.Uint64(k)
+			}
+		}
+		return bCursors.Put(key, seqKey(seq))
+	})
+}
+
+// Window returns the newest items of feed with url rawurl. If items
+// is positive Window returns at most items orders, if days is positive
+// Window returns orders published in last days. Items are sorted from
+// the newest to the oldest
+func (a *Archive) Window(rawurl string, items, days int) (
+	window []*FeedItem, err error) {
+	if items <= 0 && days <= 0 {
+		return nil, errors.New("Window: passed empty window")
+	}
+	var since time.Time
+	if days > 0 {
+		since = time.Now().AddDate(0, 0, -days)
+	}
+	err = a.db.View(func(tx *bolt.Tx) error {
+		bFeed, err := feedBucket(tx, FeedID(rawurl), false)
+		if err != nil || bFeed == nil {
+			return err
+		}
+		return readItems(tx, bFeed, func(item *FeedItem) bool {
+			if items > 0 && len(window) >= items {
+				return false
+			}
+			// items are not sorted strictly by publish date, so
+			// old items are skipped but reading goes on
+			if days <= 0 || !item.PubDate.Before(since) {
+				window = append(window, item)
+			}
+			return true
+		})
+	})
+	return
+}
+
+// FeedSize returns count of items in history of feed with url rawurl
+func (a *Archive) FeedSize(rawurl string) (size int, err error) {
+	err = a.db.View(func(tx *bolt.Tx) error {
+		bFeed, err := feedBucket(tx, FeedID(rawurl), false)
+		if err != nil || bFeed == nil {
+			return err
+		}
+		c := bFeed.Bucket(_FEED_BUCKET_ITEMS).Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.Next() {
+			size++
+		}
+		return nil
+	})
+	return
+}
+
+// ItemsToOrders converts feed items to orders
+func ItemsToOrders(items []*FeedItem) []*Order {
+	orders := make([]*Order, len(items))
+	for i, item := range items {
+		orders[i] = item.ToOrder()
+	}
+	return orders
+}
@@ -1,9 +1,9 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"math/rand"
 	"net/http"
 	"net/url"
@@ -11,8 +11,9 @@ import (
 )
 
 const (
-	_URL_REQUIRED_SCHEME = "http"
-	_URL_REQUIRED_HOST   = "zakupki.gov.ru"
+	_URL_REQUIRED_SCHEME     = "http"
+	_URL_REQUIRED_HOST       = "zakupki.gov.ru"
+	_URL_REQUIRED_ALIAS_HOST = "www.zakupki.gov.ru"
 
 	_URL_REQUIRED_QUICK_SEARCH_PATH    = "/epz/order/quicksearch/orderCsvSettings/quickSearch/download.html"
 	_URL_REQUIRED_EXTENDED_SEARCH_PATH = "/epz/order/extendedsearch/orderCsvSettings/extendedSearch/download.html"
@@ -20,6 +21,17 @@ const (
 	_URL_REQUIRED_SORTING_DIRECTION    = "false"
 )
 
+// Value of param conf of csv stream: all columns are included
+const _URL_CSV_COLUMNS = "true;true;true;true;true;true;true;true;" +
+	"true;true;true;true;true;true;true;true;true;true;"
+
+// SearchPaths maps paths of search pages to paths of csv streams
+var SearchPaths = map[string]string{
+	"/epz/order/extendedsearch/search.html": _URL_REQUIRED_EXTENDED_SEARCH_PATH,
+	"/epz/order/quicksearch/search.html":    _URL_REQUIRED_QUICK_SEARCH_PATH,
+	"/epz/order/quicksearch/update.html":    _URL_REQUIRED_QUICK_SEARCH_PATH,
+}
+
 var RandGen = rand.New(rand.NewSource(time.Now().UnixNano()))
 
 var UserAgents = []string{
@@ -75,7 +87,8 @@ var UserAgents = []string{
 	"Mozilla/5.0 (Windows NT 6.1; WOW64; rv:24.0) Gecko/20100101 Thunderbird/24.3.0",
 }
 
-func Load(rawurl string) (*http.Response, error) {
+// ParseSearchURL parses and checks url of csv stream or of search page
+func ParseSearchURL(rawurl string) (*url.URL, error) {
 	if len(rawurl) == 0 {
 		return nil, errors.New("Can't load: passed empty url string")
 	}
@@ -91,33 +104,67 @@ func Load(rawurl string) (*http.Response, error) {
 		return nil, errors.New("Invalid url scheme")
 	}
 	if URL.Host != _URL_REQUIRED_HOST {
-		return nil, errors.New("Invalid url host")
+		if URL.Host != _URL_REQUIRED_ALIAS_HOST {
+			return nil, errors.New("Invalid url host")
+		}
 	}
 	if URL.Path != _URL_REQUIRED_QUICK_SEARCH_PATH {
 		if URL.Path != _URL_REQUIRED_EXTENDED_SEARCH_PATH {
-			return nil, fmt.Errorf("Invalid url path: %q", URL.Path)
+			if _, ok := SearchPaths[URL.Path]; !ok {
+				return nil, fmt.Errorf("Invalid url path: %q", URL.Path)
+			}
 		}
 	}
 
-	log.Printf("Loading %q, url: %s\n", URL.Query().Get("searchString"), URL)
+	return URL, nil
+}
 
-	// Param sortBy defines type of sorting
-	if URL.Query().Get("sortBy") != _URL_REQUIRED_SORTING_TYPE {
-		log.Println("Result will not sorted by publish date!")
+// NormalizeSearchURL rewrites checked url of csv stream or of search
+// page into url of csv stream with all columns sorted descending by
+// publish date. Passed url isn't modified
+func NormalizeSearchURL(URL *url.URL) *url.URL {
+	normURL := *URL
+	normURL.Host = _URL_REQUIRED_HOST
+	if path, ok := SearchPaths[normURL.Path]; ok {
+		normURL.Path = path
 	}
-	// Param sortDirection defines sorting direction
-	if URL.Query().Get("sortDirection") != _URL_REQUIRED_SORTING_DIRECTION {
-		log.Println("Invalid sorting direction!")
+
+	vals := normURL.Query()
+	if normURL.Path == _URL_REQUIRED_QUICK_SEARCH_PATH {
+		vals.Set("quickSearch", "true")
+	} else {
+		vals.Set("quickSearch", "false")
 	}
+	vals.Set("sortBy", _URL_REQUIRED_SORTING_TYPE)
+	vals.Set("sortDirection", _URL_REQUIRED_SORTING_DIRECTION)
+	vals.Set("userId", "null")
+	vals.Set("conf", _URL_CSV_COLUMNS)
+	normURL.RawQuery = vals.Encode()
+
+	return &normURL
+}
+
+// Load requests csv stream of search url rawurl. Request is cancelled
+// when ctx is done
+func Load(ctx context.Context, rawurl string) (*http.Response, error) {
+	URL, err := ParseSearchURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+
 	// This app is useful if and only if orders will sorted descending
 	// by publish date!
+	URL = NormalizeSearchURL(URL)
+
+	LogDebugf("Loading %q, url: %s\n", URL.Query().Get("searchString"), URL)
 
-	return http.DefaultClient.Do(&http.Request{
+	req := &http.Request{
 		URL:   URL,
 		Proto: "HTTP/1.1",
 		Header: http.Header{
 			"User-Agent": {UserAgents[RandGen.Intn(len(UserAgents))]},
 		},
 		Host: URL.Host,
-	})
+	}
+	return http.DefaultClient.Do(req.WithContext(ctx))
 }
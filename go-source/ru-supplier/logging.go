@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"log"
+)
+
+// Log levels. Errors are always logged with log.Print* functions,
+// other messages are logged with LogInfo and LogDebug
+const (
+	_LOG_LEVEL_DEBUG = "debug"
+	_LOG_LEVEL_INFO  = "info"
+	_LOG_LEVEL_ERROR = "error"
+)
+
+var logLevels = map[string]int{
+	_LOG_LEVEL_DEBUG: 0,
+	_LOG_LEVEL_INFO:  1,
+	_LOG_LEVEL_ERROR: 2,
+}
+
+var logLevel = logLevels[_LOG_LEVEL_INFO]
+
+// SetLogLevel sets level of logged messages
+func SetLogLevel(level string) error {
+	l, ok := logLevels[level]
+	if !ok {
+		return errors.New("Invalid log level " + level)
+	}
+	logLevel = l
+	return nil
+}
+
+// LogInfo logs messages about server state
+func LogInfo(v ...interface{}) {
+	if logLevel <= logLevels[_LOG_LEVEL_INFO] {
+		log.Println(v...)
+	}
+}
+
+// LogInfof logs formatted message about server state
+func LogInfof(format string, v ...interface{}) {
+	if logLevel <= logLevels[_LOG_LEVEL_INFO] {
+		log.Printf(format, v...)
+	}
+}
+
+// LogDebugf logs formatted message about each request
+func LogDebugf(format string, v ...interface{}) {
+	if logLevel <= logLevels[_LOG_LEVEL_DEBUG] {
+		log.Printf(format, v...)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// length of base64 lines in message body
+const _MAIL_LINE_LENGTH = 76
+
+// Timeout of mail sending session including connection, so stalled
+// mail server doesn't block digests and alerts
+const _MAIL_TIMEOUT = time.Minute
+
+// SMTPConfig contains mail server settings. If StartTLS is true
+// connection is encrypted with STARTTLS before authentication. If
+// Username is empty mail is sent without authentication
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string `json:",omitempty"`
+	Password string `json:",omitempty"`
+	From     string
+	StartTLS bool
+}
+
+// Verify checks mail server settings
+func (c *SMTPConfig) Verify() error {
+	if len(c.Host) == 0 || c.Port <= 0 || c.Port > 65535 {
+		return errors.New("SMTP: invalid server address")
+	}
+	if len(c.From) == 0 {
+		return errors.New("SMTP: empty sender address")
+	}
+	return nil
+}
+
+func (c *SMTPConfig) addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// Mailer sends html mails
+type Mailer struct {
+	config *SMTPConfig
+}
+
+func NewMailer(config *SMTPConfig) *Mailer {
+	if config == nil {
+		panic("NewMailer(): passed nil config")
+	}
+	return &Mailer{config}
+}
+
+// Send sends html mail with subject to recipients from to
+func (m *Mailer) Send(to []string, subject, html string) error {
+	if len(to) == 0 {
+		return errors.New("Mailer: no recipients")
+	}
+
+	conn, err := net.DialTimeout("tcp", m.config.addr(), _MAIL_TIMEOUT)
+	if err != nil {
+		return err
+	}
+	if err = conn.SetDeadline(time.Now().Add(_MAIL_TIMEOUT)); err != nil {
+		conn.Close()
+		return err
+	}
+	c, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if m.config.StartTLS {
+		if err = c.StartTLS(&tls.Config{ServerName: m.config.Host}); err != nil {
+			return err
+		}
+	}
+	if len(m.config.Username) > 0 {
+		// net/smtp refuses to send password without tls except to
+		// localhost
+		err = c.Auth(smtp.PlainAuth("", m.config.Username,
+			m.config.Password, m.config.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = c.Mail(m.config.From); err != nil {
+		return err
+	}
+	for _, addr := range to {
+		if err = c.Rcpt(addr); err != nil {
+			return err
+		}
+	}
+
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(makeMessage(m.config.From, to, subject,
+		html)); err != nil {
+		w.Close()
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// makeMessage makes mime message with base64 encoded html body
+func makeMessage(from string, to []string, subject, html string) []byte {
+	buff := bytes.NewBuffer(nil)
+	fmt.Fprintf(buff, "From: %s\r\n", from)
+	fmt.Fprintf(buff, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(buff, "Subject: %s\r\n",
+		mime.BEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(buff, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buff.WriteString("MIME-Version: 1.0\r\n")
+	buff.WriteString("Content-Type: text/html; charset=utf-8\r\n")
+	buff.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	body := base64.StdEncoding.EncodeToString([]byte(html))
+	for len(body) > _MAIL_LINE_LENGTH {
+		buff.WriteString(body[:_MAIL_LINE_LENGTH] + "\r\n")
+		body = body[_MAIL_LINE_LENGTH:]
+	}
+	buff.WriteString(body + "\r\n")
+	return buff.Bytes()
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
-	"time"
+	"path/filepath"
 )
 
 const (
@@ -14,19 +15,38 @@ const (
 )
 
 func main() {
-	if logfile, err := os.OpenFile(
-		fmt.Sprintf(_LOG_FILE_NAME_FORMAT, time.Now().
-			Format("2006-01-02")),
-		os.O_CREATE|os.O_WRONLY|os.O_APPEND,
-		os.ModePerm,
-	); err != nil {
-		log.Fatal(err)
-	} else {
-		log.SetFlags(log.LstdFlags)
+	opts, err := ParseOptions(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if len(opts.DataDir) > 0 {
+		if err = os.MkdirAll(opts.DataDir, 0755); err != nil {
+			log.Fatal("Cannot create data directory:", err)
+		}
+	}
+
+	log.SetFlags(log.LstdFlags)
+	if logPath := opts.LogPath(); len(logPath) > 0 {
+		logfile, err := os.OpenFile(
+			logPath,
+			os.O_CREATE|os.O_WRONLY|os.O_APPEND,
+			os.ModePerm,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
 		log.SetOutput(logfile)
 	}
+	if err = SetLogLevel(opts.LogLevel); err != nil {
+		log.Fatal(err)
+	}
 
-	config, err := LoadConfig(_CONFIG_FILE_NAME)
+	config, err := LoadConfig(opts.Path(opts.Config))
 	if config == nil {
 		if err != nil {
 			log.Fatal("Cannot load configs:", err)
@@ -36,8 +56,14 @@ func main() {
 	if err != nil {
 		log.Println("Config:", err)
 	}
+	config.Override(ConfigPaths{
+		DataDir:           opts.DataDir,
+		CacheFile:         opts.Path(opts.Cache),
+		FilterProfilesDir: filepath.Dir(opts.Path(opts.Filters)),
+		DocsDir:           opts.DocsPath(),
+	}, opts.Host, opts.Port, opts.BaseURL)
 
-	filter, err := LoadFilter(_FILTERS_FILE_NAME)
+	filter, err := LoadFilter(opts.Path(opts.Filters))
 	if filter == nil {
 		if err != nil {
 			log.Fatal("Cannot load filters:", err)
@@ -48,8 +74,36 @@ func main() {
 		log.Println("Filter:", err)
 	}
 
+	archive, err := OpenArchive(opts.Path(opts.Archive))
+	if err != nil {
+		log.Fatal("Cannot open archive:", err)
+	}
+	defer archive.Close()
+
+	searches, err := LoadSearches(opts.Path(opts.Searches))
+	if searches == nil {
+		if err != nil {
+			log.Fatal("Cannot load saved searches:", err)
+		}
+		panic("Searches object is nil")
+	}
+	if err != nil {
+		log.Println("Searches:", err)
+	}
+
+	dead, err := LoadDeadLetters(opts.Path(opts.DeadLetters))
+	if dead == nil {
+		if err != nil {
+			log.Fatal("Cannot load webhook dead letters:", err)
+		}
+		panic("Dead letters object is nil")
+	}
+	if err != nil {
+		log.Println("Dead letters:", err)
+	}
+
 	if err = InterfaceStart(
-		NewServer(config, filter),
+		NewServer(config, filter, archive, searches, dead),
 		config,
 	); err != nil {
 		log.Fatal("Interface fatal error:", err)
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Prefix of metric names
+const _METRICS_PREFIX = "ru_supplier_"
+
+// Status label of upstream requests which failed without response
+const _METRICS_STATUS_ERROR = "error"
+
+// Max count of feeds with counters of served orders, counters of the
+// least recently served feed are removed when limit is exceeded
+const _METRICS_FEEDS_LIMIT = 100
+
+// Upper bounds of buckets of upstream latency histogram in seconds
+var upstreamBuckets = []float64{0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// upstreamMetrics is latency histogram of upstream requests with one
+// status
+type upstreamMetrics struct {
+	count   int
+	sum     float64
+	buckets []int // count of requests in each bucket of upstreamBuckets
+}
+
+// feedMetrics contains counters of orders served in one feed
+type feedMetrics struct {
+	emitted int // orders served to rss clients
+	checked int // orders passed to filter
+	removed int // orders removed by filter
+	updated time.Time
+}
+
+// Metrics collects counters which are not kept by diagnostics and
+// scheduler and writes all metrics in Prometheus text format
+type Metrics struct {
+	mutex    sync.Mutex
+	upstream map[string]*upstreamMetrics // by response status
+	feeds    map[string]*feedMetrics     // by feed url
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		upstream: make(map[string]*upstreamMetrics),
+		feeds:    make(map[string]*feedMetrics),
+	}
+}
+
+// UpstreamRequest registers request to zakupki.gov.ru with response
+// status and time of waiting for response
+func (m *Metrics) UpstreamRequest(status string, latency time.Duration) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	um, ok := m.upstream[status]
+	if !ok {
+		um = &upstreamMetrics{buckets: make([]int, len(upstreamBuckets))}
+		m.upstream[status] = um
+	}
+	seconds := latency.Seconds()
+	um.count++
+	um.sum += seconds
+	for i, bound := range upstreamBuckets {
+		if seconds <= bound {
+			um.buckets[i]++
+		}
+	}
+}
+
+// OrdersServed registers orders of feed with url rawurl which were
+// checked by filter and served to rss client. Removed is count of
+// orders removed by filter. Requests without orders aren't registered
+func (m *Metrics) OrdersServed(rawurl string, emitted, checked,
+	removed int) {
+	if emitted == 0 && checked == 0 {
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	fm, ok := m.feeds[rawurl]
+	if !ok {
+		if len(m.feeds) >= _METRICS_FEEDS_LIMIT {
+			m.evict()
+		}
+		fm = new(feedMetrics)
+		m.feeds[rawurl] = fm
+	}
+	fm.emitted += emitted
+	fm.checked += checked
+	fm.removed += removed
+	fm.updated = time.Now()
+}
+
+// evict removes counters of the least recently served feed. Mutex must
+// be locked
+func (m *Metrics) evict() {
+	var oldest string
+	for rawurl, fm := range m.feeds {
+		if len(oldest) == 0 || fm.updated.Before(m.feeds[oldest].updated) {
+			oldest = rawurl
+		}
+	}
+	delete(m.feeds, oldest)
+}
+
+// MetricsSnapshot contains state of proxy which is written with
+// collected metrics. Feed labels are made by Label
+type MetricsSnapshot struct {
+	Paused      bool
+	CacheSize   int
+	Diagnostics []*FeedDiagnostics
+	Polls       map[string]PollState
+	Label       func(rawurl string) string
+}
+
+// Render writes metrics in Prometheus text format
+func (m *Metrics) Render(w io.Writer, snap *MetricsSnapshot) error {
+	mw := &metricsWriter{w: w}
+	now := time.Now()
+
+	paused := 0
+	if snap.Paused {
+		paused = 1
+	}
+	mw.header("paused", "gauge", "1 if proxy is stopped from dashboard")
+	mw.sample("paused", "", float64(paused))
+	mw.header("cache_entries", "gauge",
+		"count of feeds in cache of last read orders")
+	mw.sample("cache_entries", "", float64(snap.CacheSize))
+
+	m.mutex.Lock()
+	statuses := make([]string, 0, len(m.upstream))
+	for status := range m.upstream {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	mw.header("upstream_requests_total", "counter",
+		"requests to zakupki.gov.ru by response status")
+	for _, status := range statuses {
+		mw.sample("upstream_requests_total", label("status", status),
+			float64(m.upstream[status].count))
+	}
+	mw.header("upstream_request_duration_seconds", "histogram",
+		"time of waiting for response of zakupki.gov.ru")
+	for _, status := range statuses {
+		um := m.upstream[status]
+		for i, bound := range upstreamBuckets {
+			mw.sample("upstream_request_duration_seconds_bucket",
+				label("status", status)+","+label("le", formatFloat(bound)),
+				float64(um.buckets[i]))
+		}
+		mw.sample("upstream_request_duration_seconds_bucket",
+			label("status", status)+","+label("le", "+Inf"),
+			float64(um.count))
+		mw.sample("upstream_request_duration_seconds_sum",
+			label("status", status), um.sum)
+		mw.sample("upstream_request_duration_seconds_count",
+			label("status", status), float64(um.count))
+	}
+
+	feeds := make(map[string]feedMetrics, len(m.feeds))
+	for rawurl, fm := range m.feeds {
+		feeds[rawurl] = *fm
+	}
+	m.mutex.Unlock()
+
+	urls := make([]string, 0, len(feeds))
+	for rawurl := range feeds {
+		urls = append(urls, rawurl)
+	}
+	sort.Strings(urls)
+
+	mw.header("orders_emitted_total", "counter",
+		"orders served to rss clients by feed")
+	for _, rawurl := range urls {
+		mw.sample("orders_emitted_total", label("feed", snap.Label(rawurl)),
+			float64(feeds[rawurl].emitted))
+	}
+	mw.header("filter_removed_ratio", "gauge",
+		"part of served orders which were removed by filter by feed")
+	for _, rawurl := range urls {
+		var ratio float64
+		if fm := feeds[rawurl]; fm.checked > 0 {
+			ratio = float64(fm.removed) / float64(fm.checked)
+		}
+		mw.sample("filter_removed_ratio", label("feed", snap.Label(rawurl)),
+			ratio)
+	}
+
+	mw.header("rows_parsed_total", "counter",
+		"csv rows which were parsed by feed")
+	for _, fd := range snap.Diagnostics {
+		mw.sample("rows_parsed_total", label("feed", snap.Label(fd.URL)),
+			float64(fd.Rows))
+	}
+	mw.header("rows_failed_total", "counter",
+		"csv rows which were not parsed by feed")
+	for _, fd := range snap.Diagnostics {
+		mw.sample("rows_failed_total", label("feed", snap.Label(fd.URL)),
+			float64(fd.FailedRows))
+	}
+
+	polled := make([]string, 0, len(snap.Polls))
+	for rawurl, state := range snap.Polls {
+		if !state.LastSuccess.IsZero() {
+			polled = append(polled, rawurl)
+		}
+	}
+	sort.Strings(polled)
+
+	mw.header("last_successful_poll_age_seconds", "gauge",
+		"time since last successful poll by saved search")
+	for _, rawurl := range polled {
+		mw.sample("last_successful_poll_age_seconds",
+			label("feed", snap.Label(rawurl)),
+			now.Sub(snap.Polls[rawurl].LastSuccess).Seconds())
+	}
+
+	return mw.err
+}
+
+// metricsWriter writes metrics lines and keeps first error
+type metricsWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (mw *metricsWriter) header(name, typ, help string) {
+	if mw.err == nil {
+		_, mw.err = fmt.Fprintf(mw.w, "# HELP %s%s %s\n# TYPE %s%s %s\n",
+			_METRICS_PREFIX, name, help, _METRICS_PREFIX, name, typ)
+	}
+}
+
+func (mw *metricsWriter) sample(name, labels string, value float64) {
+	if mw.err != nil {
+		return
+	}
+	if len(labels) > 0 {
+		labels = "{" + labels + "}"
+	}
+	_, mw.err = fmt.Fprintf(mw.w, "%s%s%s %s\n", _METRICS_PREFIX, name,
+		labels, formatFloat(value))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func label(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
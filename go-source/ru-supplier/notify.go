@@ -0,0 +1,41 @@
+package main
+
+// FeedEvent contains new orders which were appended into feed history
+type FeedEvent struct {
+	URL    string
+	Search *SavedSearch // nil if feed is not saved search
+	Items  []*FeedItem  // from the oldest to the newest
+}
+
+// Slug returns slug of saved search or empty string
+func (e *FeedEvent) Slug() string {
+	if e.Search != nil {
+		return e.Search.Slug
+	}
+	return ""
+}
+
+// Notifier is notified about new filtered orders of polled feeds.
+// Notify must not block fetching for a long time
+type Notifier interface {
+	Notify(event *FeedEvent)
+}
+
+// FilterItems returns items which orders pass filter
+func FilterItems(items []*FeedItem, filter OrderFilter) []*FeedItem {
+	if len(items) == 0 {
+		return items
+	}
+	orders, _ := filter.Execute(ItemsToOrders(items))
+	passed := make(map[string]bool, len(orders))
+	for _, order := range orders {
+		passed[order.Key()] = true
+	}
+	var result []*FeedItem
+	for _, item := range items {
+		if passed[item.Key()] {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	_OPML_VERSION = "2.0"
+	_OPML_TITLE   = "Ленты закупок"
+)
+
+// OPML is subscription list of rss feeds
+type OPML struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    OPMLHead `xml:"head"`
+	Body    OPMLBody `xml:"body"`
+}
+
+type OPMLHead struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type OPMLBody struct {
+	Outlines []*OPMLOutline `xml:"outline"`
+}
+
+// OPMLOutline is feed or group of feeds if it contains outlines
+type OPMLOutline struct {
+	Text     string         `xml:"text,attr"`
+	Title    string         `xml:"title,attr,omitempty"`
+	Type     string         `xml:"type,attr,omitempty"`
+	XMLURL   string         `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string         `xml:"htmlUrl,attr,omitempty"`
+	Outlines []*OPMLOutline `xml:"outline"`
+}
+
+// MakeOPML makes subscription list with feeds of saved searches. Feed
+// links are made with public url base and contain access token if it
+// isn't empty
+func MakeOPML(list []*SavedSearch, base, token string) *OPML {
+	opml := &OPML{
+		Version: _OPML_VERSION,
+		Head: OPMLHead{
+			Title:       _OPML_TITLE,
+			DateCreated: time.Now().Format(time.RFC1123),
+		},
+	}
+	for _, ss := range list {
+		opml.Body.Outlines = append(opml.Body.Outlines, &OPMLOutline{
+			Text:    ss.Name,
+			Title:   ss.Name,
+			Type:    "rss",
+			XMLURL:  AddAccessToken(MakeFeedLink(ss.Slug, base), token),
+			HTMLURL: _FEED_LINK,
+		})
+	}
+	return opml
+}
+
+// Render writes opml document
+func (opml *OPML) Render(w io.Writer) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	return enc.Encode(opml)
+}
+
+// ReadOPML reads opml document
+func ReadOPML(r io.Reader) (*OPML, error) {
+	opml := new(OPML)
+	if err := xml.NewDecoder(r).Decode(opml); err != nil {
+		return nil, err
+	}
+	return opml, nil
+}
+
+// Feeds returns all feed outlines including nested
+func (opml *OPML) Feeds() []*OPMLOutline {
+	var (
+		feeds []*OPMLOutline
+		walk  func([]*OPMLOutline)
+	)
+	walk = func(outlines []*OPMLOutline) {
+		for _, outline := range outlines {
+			if len(outline.XMLURL) > 0 {
+				feeds = append(feeds, outline)
+			}
+			walk(outline.Outlines)
+		}
+	}
+	walk(opml.Body.Outlines)
+	return feeds
+}
+
+// ImportResult contains saved searches which were created by opml
+// import and feeds which were skipped with reasons
+type ImportResult struct {
+	Imported []*SavedSearch
+	Skipped  []*ImportSkip
+}
+
+type ImportSkip struct {
+	URL    string
+	Reason string
+}
+
+// SavedSearchFromOutline converts outline with feed link /rss?url=
+// into saved search
+func SavedSearchFromOutline(outline *OPMLOutline) (*SavedSearch, error) {
+	feedURL, err := url.Parse(outline.XMLURL)
+	if err != nil {
+		return nil, err
+	}
+	// link may contain path prefix of proxy
+	if !strings.HasSuffix(feedURL.Path, _PATH_TO_RSS) {
+		return nil, errors.New("Link is not " + _PATH_TO_RSS +
+			"?url= feed link")
+	}
+	searchURL, err := ConvertSearchURL(feedURL.Query().Get("url"))
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(outline.Title)
+	if len(name) == 0 {
+		name = strings.TrimSpace(outline.Text)
+	}
+	if len(name) == 0 {
+		name = searchURL.Query().Get("searchString")
+	}
+	if len(name) == 0 {
+		name = _DEFAULT_TITLE
+	}
+
+	return &SavedSearch{Name: name, URL: searchURL.String()}, nil
+}
+
+// ImportOPML creates saved searches by feeds with links /rss?url= from
+// opml document. Feeds which are already saved are skipped
+func ImportOPML(searches *Searches, opml *OPML) *ImportResult {
+	result := &ImportResult{
+		Imported: []*SavedSearch{},
+		Skipped:  []*ImportSkip{},
+	}
+	for _, outline := range opml.Feeds() {
+		ss, err := SavedSearchFromOutline(outline)
+		if err == nil {
+			if searches.Contains(ss.URL) {
+				err = ErrSearchExists
+			} else {
+				err = searches.Add(ss)
+			}
+		}
+		if err != nil {
+			result.Skipped = append(result.Skipped,
+				&ImportSkip{outline.XMLURL, err.Error()})
+		} else {
+			result.Imported = append(result.Imported, ss)
+		}
+	}
+	return result
+}
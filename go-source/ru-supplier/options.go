@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Prefix of environment variables
+const _ENV_PREFIX = "RU_SUPPLIER_"
+
+// Log destination which means standard error output
+const _LOG_STDERR = "stderr"
+
+// Options contains command line flags and environment variables. Each
+// option is set by flag -NAME or by variable RU_SUPPLIER_NAME (upper
+// case, - is replaced by _). Precedence of settings: flag, environment
+// variable, config.json, defaultConfig. Relative file paths are
+// relative to data directory
+type Options struct {
+	DataDir     string
+	Config      string
+	Filters     string
+	Archive     string
+	Searches    string
+	DeadLetters string
+	Cache       string
+	Docs        string // documentation directory
+	Host, Port  string // override Host and Port of config.json
+	BaseURL     string // overrides BaseURL of config.json
+	Log         string // log file or stderr
+	LogLevel    string
+}
+
+// optionFlag describes option: flag name, pointer to value, default
+// value and usage
+type optionFlag struct {
+	name  string
+	value *string
+	def   string
+	usage string
+}
+
+func (o *Options) optionFlags() []*optionFlag {
+	return []*optionFlag{
+		{"data-dir", &o.DataDir, "", "directory with settings and data, current directory by default"},
+		{"config", &o.Config, _CONFIG_FILE_NAME, "config file"},
+		{"filters", &o.Filters, _FILTERS_FILE_NAME, "filter file, filter profiles are loaded from its directory"},
+		{"archive", &o.Archive, _ARCHIVE_FILE_NAME, "archive database file"},
+		{"searches", &o.Searches, _SEARCHES_FILE_NAME, "saved searches file"},
+		{"dead-letters", &o.DeadLetters, _DEAD_LETTERS_FILE_NAME, "undelivered webhooks file"},
+		{"cache", &o.Cache, _HASH_STORE_FILE_NAME, "cache file"},
+		{"docs", &o.Docs, "", "documentation directory, " + _DOCS_DIR +
+			" near program by default"},
+		{"host", &o.Host, "", "listen host, Host of config file by default"},
+		{"port", &o.Port, "", "listen port, Port of config file by default"},
+		{"base-url", &o.BaseURL, "", "public url of proxy with scheme and optional path prefix, BaseURL of config file by default"},
+		{"log", &o.Log, "", "log file or " + _LOG_STDERR + ", " +
+			fmt.Sprintf(_LOG_FILE_NAME_FORMAT, "<date>") + " by default"},
+		{"log-level", &o.LogLevel, _LOG_LEVEL_INFO, "log level: " +
+			_LOG_LEVEL_DEBUG + ", " + _LOG_LEVEL_INFO + " or " +
+			_LOG_LEVEL_ERROR},
+	}
+}
+
+// ParseOptions parses command line arguments args without program name
+// and environment variables
+func ParseOptions(args []string) (*Options, error) {
+	opts := new(Options)
+	set := flag.NewFlagSet("ru-supplier", flag.ContinueOnError)
+	for _, f := range opts.optionFlags() {
+		def := f.def
+		if env := os.Getenv(envName(f.name)); len(env) > 0 {
+			def = env
+		}
+		set.StringVar(f.value, f.name, def,
+			f.usage+" (env "+envName(f.name)+")")
+	}
+	if err := set.Parse(args); err != nil {
+		return nil, err
+	}
+	if set.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %v", set.Args())
+	}
+	if len(opts.BaseURL) > 0 {
+		if err := VerifyBaseURL(opts.BaseURL); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := logLevels[opts.LogLevel]; !ok {
+		return nil, fmt.Errorf("invalid log level %q", opts.LogLevel)
+	}
+	return opts, nil
+}
+
+// envName returns environment variable name of flag
+func envName(flagName string) string {
+	name := []byte(_ENV_PREFIX + flagName)
+	for i, c := range name {
+		switch {
+		case c == '-':
+			name[i] = '_'
+		case c >= 'a' && c <= 'z':
+			name[i] = c - 'a' + 'A'
+		}
+	}
+	return string(name)
+}
+
+// Path returns path of file fname in data directory
+func (o *Options) Path(fname string) string {
+	if filepath.IsAbs(fname) {
+		return fname
+	}
+	return filepath.Join(o.DataDir, fname)
+}
+
+// LogPath returns path of log file or empty string for stderr
+func (o *Options) LogPath() string {
+	switch o.Log {
+	case _LOG_STDERR:
+		return ""
+	case "":
+		return o.Path(fmt.Sprintf(_LOG_FILE_NAME_FORMAT,
+			time.Now().Format("2006-01-02")))
+	}
+	return o.Path(o.Log)
+}
+
+// DocsPath returns path of documentation directory. By default docs
+// are near program, so they are found with any data and working
+// directory
+func (o *Options) DocsPath() string {
+	if len(o.Docs) > 0 {
+		return o.Path(o.Docs)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return o.Path(_DOCS_DIR)
+	}
+	return filepath.Join(filepath.Dir(exe), _DOCS_DIR)
+}
@@ -227,6 +227,11 @@ func NewOrder(row [_ORDER_COLUMN_COUNT]string) (order *Order) {
 	return
 }
 
+// Key returns unique order key: order id and exhibition number
+func (order *Order) Key() string {
+	return order.OrderId + "/" + strconv.Itoa(order.ExhibitionNumber)
+}
+
 func (order *Order) PushError(err error) {
 	if err != nil {
 		order.Errors = append(order.Errors, err)
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format of dates in search params
+const _QUERY_DATE_FORMAT = "02.01.2006"
+
+// SearchQuery is search of zakupki.gov.ru. Laws are codes of param
+// placeOfSearch (FZ_44, FZ_223, FZ_94, PP_RF_615), stages are codes of
+// param orderStages (AF, CA, PC, PA), dates are in format DD.MM.YYYY,
+// prices are in rubles and zero price is not limited. Search with
+// customer or regions is extended search
+type SearchQuery struct {
+	Keywords    string   `json:",omitempty"`
+	Morphology  bool     `json:",omitempty"`
+	Laws        []string `json:",omitempty"`
+	PriceFrom   int64    `json:",omitempty"`
+	PriceTo     int64    `json:",omitempty"`
+	Stages      []string `json:",omitempty"`
+	PublishFrom string   `json:",omitempty"`
+	PublishTo   string   `json:",omitempty"`
+	Customer    string   `json:",omitempty"`
+	Regions     []string `json:",omitempty"` // region ids of portal
+	Extended    bool     `json:",omitempty"`
+}
+
+// IsExtended returns true if query requires extended search
+func (q *SearchQuery) IsExtended() bool {
+	return q.Extended || len(q.Customer) > 0 || len(q.Regions) > 0
+}
+
+// Verify checks query fields
+func (q *SearchQuery) Verify() error {
+	for _, law := range q.Laws {
+		if _, ok := searchLaws[law]; !ok {
+			return fmt.Errorf("Invalid law %q", law)
+		}
+	}
+	for _, stage := range q.Stages {
+		if _, ok := searchStages[stage]; !ok {
+			return fmt.Errorf("Invalid order stage %q", stage)
+		}
+	}
+	if q.PriceFrom < 0 || q.PriceTo < 0 ||
+		q.PriceTo > 0 && q.PriceFrom > q.PriceTo {
+		return errors.New("Invalid price range")
+	}
+	var from, to time.Time
+	var err error
+	if len(q.PublishFrom) > 0 {
+		if from, err = time.Parse(_QUERY_DATE_FORMAT,
+			q.PublishFrom); err != nil {
+			return fmt.Errorf("Invalid publish date %q", q.PublishFrom)
+		}
+	}
+	if len(q.PublishTo) > 0 {
+		if to, err = time.Parse(_QUERY_DATE_FORMAT,
+			q.PublishTo); err != nil {
+			return fmt.Errorf("Invalid publish date %q", q.PublishTo)
+		}
+	}
+	if !from.IsZero() && !to.IsZero() && from.After(to) {
+		return errors.New("Invalid publish date range")
+	}
+	for _, region := range q.Regions {
+		if _, err = strconv.ParseUint(region, 10, 64); err != nil {
+			return fmt.Errorf("Invalid region id %q", region)
+		}
+	}
+	return nil
+}
+
+// URL makes url of csv stream of query
+func (q *SearchQuery) URL() string {
+	vals := url.Values{}
+	vals.Set("searchString", q.Keywords)
+	vals.Set("morphology", strconv.FormatBool(q.Morphology))
+	for _, law := range q.Laws {
+		vals.Add("placeOfSearch", law)
+		vals.Add("_placeOfSearch", "on")
+	}
+	if q.PriceFrom > 0 {
+		vals.Set("priceFrom", strconv.FormatInt(q.PriceFrom, 10))
+	}
+	if q.PriceTo > 0 {
+		vals.Set("priceTo", strconv.FormatInt(q.PriceTo, 10))
+	}
+	for _, stage := range q.Stages {
+		vals.Add("orderStages", stage)
+		vals.Add("_orderStages", "on")
+	}
+	if len(q.PublishFrom) > 0 {
+		vals.Set("publishDateFrom", q.PublishFrom)
+	}
+	if len(q.PublishTo) > 0 {
+		vals.Set("publishDateTo", q.PublishTo)
+	}
+	if len(q.Customer) > 0 {
+		vals.Set("customerTitle", q.Customer)
+	}
+	for _, region := range q.Regions {
+		vals.Add("regions", region)
+	}
+
+	URL := &url.URL{
+		Scheme:   _URL_REQUIRED_SCHEME,
+		Host:     _URL_REQUIRED_HOST,
+		Path:     _URL_REQUIRED_QUICK_SEARCH_PATH,
+		RawQuery: vals.Encode(),
+	}
+	if q.IsExtended() {
+		URL.Path = _URL_REQUIRED_EXTENDED_SEARCH_PATH
+	}
+	return NormalizeSearchURL(URL).String()
+}
+
+// ParseSearchQuery reads query from url of csv stream or of search page.
+// Unknown params are ignored
+func ParseSearchQuery(rawurl string) (*SearchQuery, error) {
+	URL, err := ParseSearchURL(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	URL = NormalizeSearchURL(URL)
+	vals := URL.Query()
+
+	q := &SearchQuery{
+		Keywords:    strings.TrimSpace(vals.Get("searchString")),
+		Morphology:  vals.Get("morphology") == "true",
+		Laws:        vals["placeOfSearch"],
+		Stages:      vals["orderStages"],
+		PublishFrom: strings.TrimSpace(vals.Get("publishDateFrom")),
+		PublishTo:   strings.TrimSpace(vals.Get("publishDateTo")),
+		Customer:    strings.TrimSpace(vals.Get("customerTitle")),
+		Regions:     vals["regions"],
+		Extended:    URL.Path == _URL_REQUIRED_EXTENDED_SEARCH_PATH,
+	}
+	if q.PriceFrom, err = parsePrice(vals.Get("priceFrom")); err != nil {
+		return nil, err
+	}
+	if q.PriceTo, err = parsePrice(vals.Get("priceTo")); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// parsePrice parses price of portal like "200 000 000 000" or "1000,50"
+// and drops kopecks
+func parsePrice(str string) (int64, error) {
+	str = strings.NewReplacer(" ", "", "\u00a0", "", ",", ".").Replace(str)
+	if len(str) == 0 {
+		return 0, nil
+	}
+	price, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid price %q", str)
+	}
+	return int64(price), nil
+}
+
+// ParseSearchQueryForm creates query by form values: keywords,
+// morphology, law, price_from, price_to, stage, publish_from,
+// publish_to, customer, comma separated regions and extended. Returns
+// nil if all values are empty
+func ParseSearchQueryForm(form url.Values) (*SearchQuery, error) {
+	q := &SearchQuery{
+		Keywords:    strings.TrimSpace(form.Get("keywords")),
+		Morphology:  len(form.Get("morphology")) > 0,
+		Laws:        form["law"],
+		Stages:      form["stage"],
+		PublishFrom: strings.TrimSpace(form.Get("publish_from")),
+		PublishTo:   strings.TrimSpace(form.Get("publish_to")),
+		Customer:    strings.TrimSpace(form.Get("customer")),
+		Extended:    len(form.Get("extended")) > 0,
+	}
+	for _, region := range strings.Split(form.Get("regions"), ",") {
+		if region = strings.TrimSpace(region); len(region) > 0 {
+			q.Regions = append(q.Regions, region)
+		}
+	}
+	var err error
+	if q.PriceFrom, err = parsePrice(form.Get("price_from")); err != nil {
+		return nil, err
+	}
+	if q.PriceTo, err = parsePrice(form.Get("price_to")); err != nil {
+		return nil, err
+	}
+	if len(q.Keywords) == 0 && len(q.Laws) == 0 && len(q.Stages) == 0 &&
+		q.PriceFrom == 0 && q.PriceTo == 0 && len(q.PublishFrom) == 0 &&
+		len(q.PublishTo) == 0 && len(q.Customer) == 0 &&
+		len(q.Regions) == 0 {
+		return nil, nil
+	}
+	return q, nil
+}
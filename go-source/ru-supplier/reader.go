@@ -19,19 +19,28 @@ const (
 )
 
 type OrderParserReader interface {
-	ReadOrders(*http.Response) ([]*Order, error)
+	ReadOrders(rawurl string, resp *http.Response) ([]*Order, error)
 	RemoveCache() error
+	CacheSize() int
 }
 
 type OrderReader struct {
 	*HashStore
+	diag *Diagnostics
 }
 
-func NewOrderReader() *OrderReader {
-	return &OrderReader{LoadHashStoreSimple()}
+// NewOrderReader creates reader which keeps cache in file fname
+func NewOrderReader(diag *Diagnostics, fname string) *OrderReader {
+	if diag == nil {
+		panic("NewOrderReader(): passed nil diagnostics")
+	}
+	return &OrderReader{LoadHashStoreSimple(fname), diag}
 }
 
-func (p *OrderReader) ReadOrders(resp *http.Response) (
+// ReadOrders reads new orders of feed with url rawurl from response.
+// Rawurl is key of feed in cache, parsing results are registered in
+// diagnostics of the feed
+func (p *OrderReader) ReadOrders(rawurl string, resp *http.Response) (
 	[]*Order, error) {
 
 	if resp == nil {
@@ -70,8 +79,6 @@ func (p *OrderReader) ReadOrders(resp *http.Response) (
 		// cut delim \n if there is
 		newestChunk = newestChunk[:len(newestChunk)-1]
 	}
-	// below get checking chunk by url
-	rawurl := resp.Request.URL.String()
 	// checking chunk was newest chunk at last time
 	checkingChunk, exists := p.HashStore.GetHashChunk(rawurl)
 	// check for updates if exists data in hashstore by comparing
@@ -84,17 +91,9 @@ func (p *OrderReader) ReadOrders(resp *http.Response) (
 			return nil, nil
 		}
 	}
-	// save newest chunk in cache
-	p.HashStore.SetHashChunk(rawurl, newestChunk)
-	if err = p.HashStore.Save(); err != nil {
-		log.Println("Can't save cache:", err)
-	}
-
 	var orders []*Order
-	if order, err := ParseOrder(newestChunk); err == nil {
+	if order := p.parseRow(rawurl, newestChunk); order != nil {
 		orders = append(orders, order)
-	} else {
-		log.Println("Parsing order error:", err)
 	}
 
 	// if exists checking chunk read while does not find matched chunk
@@ -107,25 +106,84 @@ func (p *OrderReader) ReadOrders(resp *http.Response) (
 	for {
 		rowData, err := brdr.ReadBytes('\n')
 		if err != nil && err != io.EOF {
-			return orders, err
+			// orders are read again next time
+			return nil, err
 		}
 		if err == io.EOF && len(rowData) == 0 {
 			break
 		}
-		if order, err := ParseOrder(rowData); err == nil {
+		if order := p.parseRow(rawurl, rowData); order != nil {
 			orders = append(orders, order)
-		} else {
-			log.Println("Parsing order error:", err)
 		}
 		if err == io.EOF {
 			break
 		}
 	}
 
+	// save newest chunk in cache only after all new orders are read,
+	// otherwise orders which were not read are skipped next time
+	p.HashStore.SetHashChunk(rawurl, newestChunk)
+	if err = p.HashStore.Save(); err != nil {
+		log.Println("Can't save cache:", err)
+	}
+
 	return orders, nil
 }
 
+// ParseOrders reads all orders of csv stream from r without cache.
+// Rows which can't be parsed are skipped
+func ParseOrders(r io.Reader) ([]*Order, error) {
+	w1251rdr, err := charset.NewReader(_STREAM_CHARSET, r)
+	if err != nil {
+		return nil, err
+	}
+	brdr := bufio.NewReaderSize(w1251rdr, _BUFFER_SIZE)
+
+	// skip first line with topics
+	if _, err = brdr.ReadString('\n'); err != nil {
+		if err == io.EOF {
+			return nil, nil
+		}
+		return nil, errors.New("Skip first line err: " + err.Error())
+	}
+
+	var orders []*Order
+	for {
+		rowData, err := brdr.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if len(rowData) > 0 {
+			if order, perr := ParseOrder(rowData); perr != nil {
+				log.Println("Parsing order error:", perr)
+			} else {
+				orders = append(orders, order)
+			}
+		}
+		if err == io.EOF {
+			return orders, nil
+		}
+	}
+}
+
+// parseRow parses order and registers result in diagnostics
+func (p *OrderReader) parseRow(rawurl string, row []byte) *Order {
+	order, err := ParseOrder(row)
+	if err != nil {
+		log.Println("Parsing order error:", err)
+		p.diag.RowFailed(rawurl, row, err)
+		return nil
+	}
+	p.diag.RowParsed(rawurl, row, order)
+	return order
+}
+
 // RemoveCache are calling cache removing
 func (p *OrderReader) RemoveCache() error {
 	return p.HashStore.Remove()
 }
+
+// CacheSize returns count of feeds in cache
+func (p *OrderReader) CacheSize() int {
+	return p.HashStore.Len()
+}
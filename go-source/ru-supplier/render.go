@@ -8,6 +8,7 @@ import (
 	"io"
 	"log"
 	"math"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -25,80 +26,95 @@ var tmpl = template.Must(template.New("tmpl").Parse(`<!DOCTYPE html>
 <html>
 	<head>
 		<title>{{.Title}}</title>
-		<style>
-			div, h1 {margin: 10px 0px;}
-			ul {margin: 10px 15px;}
-			h1 {font-size: 15pt;}
-			a, s {text-decoration: none;}
-			a {color: #000;}
-			a:hover {background-color: #444; color: #fff;}
-			s {color: #f00;}
-			b {color: #999; margin-right: 8px;}
-			i {color: #89f;}
-		</style>
+		{{template "style"}}
 	</head>
 	<body>
-		<h1>
-			<b>{{if .LawId}}{{.LawId}}{{else}}??-ФЗ{{end}}</b>
-			{{.Title}}
-		</h1>
-		<div>
-			<a href="{{.Link}}">
-				{{if .OrderName}}{{.OrderName}}{{else}}unknown{{end}}
-			</a>
-		</div>
-		{{if .OKDP}}
-			<div><b>ОКДП:</b> {{.OKDP}}</div>
-		{{end}}
-		{{if .OKPD}}
-			<div><b>ОКПД:</b> {{.OKPD}}</div>
-		{{end}}
-		<div>
-			<b>Сроки подачи заявки:</b>
-			с
-			{{if .StartFilingDate}}{{.StartFilingDate}}
-			{{else}}00.00.0000{{end}}
-			по
-			<s>
-				{{if .FinishFilingDate}}{{.FinishFilingDate}}
-				{{else}}00.00.0000{{end}}
-			</s>
-		</div>
-		<div>
-			<b>Начальная (максимальная) цена:</b>
-			{{.StartOrderPrice}}
-			{{if .CurrencyId}}{{.CurrencyId}}
-			{{else}}unknown currency{{end}}
-		</div>
-		<hr />
-		{{if .OrderType}}
-			<div><b>Тип закупки:</b> {{.OrderType}}</div>
-		{{end}}
-		{{if .OrderStage}}
-			<div><b>Этап закупки:</b> {{.OrderStage}}</div>
-		{{end}}
-		{{if .PubDate}}
-			<div><b>Дата публикации извещения:</b> {{.PubDate}}</div>
-		{{end}}
-		{{if .OrganisationName}}
-			<div><b>Организация:</b> {{.OrganisationName}}</div>
-		{{end}}
-		{{if .Features}}
-			<div><i>{{.Features}}</i></div>
-		{{end}}
-		{{if .Errors}}
-			<hr />
-			<div>
-				<s>Проверьте извещение</s>, были обнаружены ошибки:
-			</div>
-			<ul>
-				{{range .Errors}}
-					<li>{{.}}</li>
-				{{end}}
-			</ul>
-		{{end}}
+		{{template "order" .}}
 	</body>
-</html>`))
+</html>
+{{define "style"}}
+<style>
+	div, h1 {margin: 10px 0px;}
+	ul {margin: 10px 15px;}
+	h1 {font-size: 15pt;}
+	a, s {text-decoration: none;}
+	a {color: #000;}
+	a:hover {background-color: #444; color: #fff;}
+	s {color: #f00;}
+	b {color: #999; margin-right: 8px;}
+	i {color: #89f;}
+</style>
+{{end}}
+{{define "order"}}
+<h1>
+	<b>{{if .LawId}}{{.LawId}}{{else}}??-ФЗ{{end}}</b>
+	{{.Title}}
+</h1>
+<div>
+	<a href="{{.Link}}">
+		{{if .OrderName}}{{.OrderName}}{{else}}unknown{{end}}
+	</a>
+</div>
+{{if .OKDP}}
+	<div><b>ОКДП:</b> {{.OKDP}}</div>
+{{end}}
+{{if .OKPD}}
+	<div><b>ОКПД:</b> {{.OKPD}}</div>
+{{end}}
+<div>
+	<b>Сроки подачи заявки:</b>
+	с
+	{{if .StartFilingDate}}{{.StartFilingDate}}
+	{{else}}00.00.0000{{end}}
+	по
+	<s>
+		{{if .FinishFilingDate}}{{.FinishFilingDate}}
+		{{else}}00.00.0000{{end}}
+	</s>
+</div>
+<div>
+	<b>Начальная (максимальная) цена:</b>
+	{{.StartOrderPrice}}
+	{{if .CurrencyId}}{{.CurrencyId}}
+	{{else}}unknown currency{{end}}
+</div>
+<hr />
+{{if .OrderType}}
+	<div><b>Тип закупки:</b> {{.OrderType}}</div>
+{{end}}
+{{if .OrderStage}}
+	<div><b>Этап закупки:</b> {{.OrderStage}}</div>
+{{end}}
+{{if .PubDate}}
+	<div><b>Дата публикации извещения:</b> {{.PubDate}}</div>
+{{end}}
+{{if .OrganisationName}}
+	<div><b>Организация:</b> {{.OrganisationName}}</div>
+{{end}}
+{{if .Features}}
+	<div><i>{{.Features}}</i></div>
+{{end}}
+{{if .StarLink}}
+	<div><a href="{{.StarLink}}">&#9734; Отслеживать срок подачи заявок</a></div>
+{{end}}
+{{if .Searches}}
+	<div>
+		<b>Найдено поисками:</b>
+		{{range $i, $name := .Searches}}{{if $i}}, {{end}}{{$name}}{{end}}
+	</div>
+{{end}}
+{{if .Errors}}
+	<hr />
+	<div>
+		<s>Проверьте извещение</s>, были обнаружены ошибки:
+	</div>
+	<ul>
+		{{range .Errors}}
+			<li>{{.}}</li>
+		{{end}}
+	</ul>
+{{end}}
+{{end}}`))
 
 // MakeTitle makes order title
 func MakeTitle(order *Order) (title string) {
@@ -111,8 +127,25 @@ func MakeTitle(order *Order) (title string) {
 
 // MakeDescription makes description for passed order
 func MakeDescription(order *Order) string {
+	return MakeItemDescription(order, nil, "")
+}
+
+// MakeItemDescription makes description of feed item with names of
+// saved searches which have found order and with link which stars order
+func MakeItemDescription(order *Order, searches []string,
+	starLink string) string {
 	buff := bytes.NewBuffer(nil)
-	err := tmpl.Execute(buff, map[string]interface{}{
+	err := tmpl.Execute(buff, descriptionData(order, searches, starLink))
+	if err != nil {
+		log.Println("Template execution error:", err)
+	}
+	return buff.String()
+}
+
+// descriptionData returns data of order description template
+func descriptionData(order *Order, searches []string,
+	starLink string) map[string]interface{} {
+	return map[string]interface{}{
 		"Title":            MakeTitle(order),
 		"LawId":            LawIdToString(order.LawId),
 		"Link":             MakeLink(order.OrderId),
@@ -129,11 +162,14 @@ func MakeDescription(order *Order) string {
 		"OrganisationName": order.OrganisationName,
 		"Features":         order.Features,
 		"Errors":           order.Errors,
-	})
-	if err != nil {
-		log.Println("Template execution error:", err)
+		"Searches":         searches,
+		"StarLink":         starLink,
 	}
-	return buff.String()
+}
+
+// MakeGuid makes stable unique id of order item
+func MakeGuid(order *Order) string {
+	return "zakupki:" + order.Key()
 }
 
 // MakeLink makes link with passed order ID
@@ -158,10 +194,20 @@ func MakeLink(id string) string {
 		"&isHeaderClick=&checkIds=")
 }
 
-// MakeShortLink makes short link
-func MakeShortLink(id, host string) string {
-	return fmt.Sprintf("http://%s/%s?order=%s", host,
-		strings.TrimLeft(_PATH_TO_SHORT_LINKS, "/"), id)
+// MakeShortLink makes short link, base is public url of proxy
+func MakeShortLink(id, base string) string {
+	return base + _PATH_TO_SHORT_LINKS + "?order=" + url.QueryEscape(id)
+}
+
+// MakeStarLink makes short link which stars order and opens it
+func MakeStarLink(order *Order, base string) string {
+	return MakeShortLink(order.OrderId, base) + "&star=" +
+		url.QueryEscape(order.Key())
+}
+
+// MakeFeedLink makes link to feed of saved search with passed slug
+func MakeFeedLink(slug, base string) string {
+	return base + _PATH_TO_FEEDS + "/" + slug
 }
 
 // LawIdToString converts OrderLaw to string
@@ -198,6 +244,7 @@ func FormatPrice(p Price) string {
 type Render struct {
 	config ServerConfig
 	feed   *feeds.RssFeed
+	token  string // access token of links of items
 }
 
 func NewRender(config ServerConfig) *Render {
@@ -207,9 +254,15 @@ func NewRender(config ServerConfig) *Render {
 			Link:        _FEED_LINK,
 			Description: _FEED_DESCRIPTION,
 		},
+		"",
 	}
 }
 
+// SetAccessToken sets access token which is added to links of items
+func (r *Render) SetAccessToken(token string) {
+	r.token = token
+}
+
 func (r *Render) SetTitle(title string) {
 	if len(title) == 0 {
 		if r.feed.Title != _DEFAULT_TITLE {
@@ -221,18 +274,33 @@ func (r *Render) SetTitle(title string) {
 }
 
 func (r *Render) Compose(orders []*Order) {
+	r.ComposeWithSearches(orders, nil)
+}
+
+// ComposeWithSearches composes feed items and notes each order with
+// names of saved searches from searches by order key
+func (r *Render) ComposeWithSearches(orders []*Order,
+	searches map[string][]string) {
 	if len(orders) > 0 {
 		r.feed.Items = make([]*feeds.RssItem, len(orders))
 		for i, order := range orders {
 			r.feed.Items[i] = &feeds.RssItem{
 				Title: MakeTitle(order),
-				Link: MakeShortLink(
+				Link: AddAccessToken(MakeShortLink(
 					order.OrderId,
-					r.config.HTTPHost(),
-				),
-				Description: MakeDescription(order),
-				Author:      order.OrganisationName,
-				PubDate:     order.PubDate.Format(time.RFC1123),
+					r.config.GetBaseURL(),
+				), r.token),
+				Description: MakeItemDescription(order,
+					searches[order.Key()],
+					AddAccessToken(MakeStarLink(order,
+						r.config.GetBaseURL()), r.token)),
+				Author: order.OrganisationName,
+				// guid doesn't change when order is served again
+				Guid: &feeds.RssGuid{
+					Id:          MakeGuid(order),
+					IsPermaLink: "false",
+				},
+				PubDate: order.PubDate.Format(time.RFC1123),
 			}
 		}
 	}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// period of checking which feeds must be polled
+	_SCHEDULER_TICK = 10 * time.Second
+	// max part of poll interval which is randomly added or subtracted
+	_SCHEDULER_JITTER = 0.1
+	// max delay after failed polls
+	_SCHEDULER_MAX_BACKOFF = 6 * time.Hour
+)
+
+// PollState contains polling statistic of one feed
+type PollState struct {
+	URL         string
+	LastPoll    time.Time // time of last poll
+	LastSuccess time.Time // time of last successful poll
+	NextPoll    time.Time
+	Failures    int    // count of failed polls in a row
+	LastError   string // error of last failed poll
+	running     bool
+}
+
+// Scheduler polls saved searches at their intervals independently of
+// rss clients
+type Scheduler struct {
+	searches *Searches
+	fetch    func(ctx context.Context, rawurl string) error
+	interval time.Duration // default poll interval
+	sem      chan struct{} // limits count of concurrent polls
+	rand     *rand.Rand
+
+	mutex  sync.Mutex
+	states map[string]*PollState
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewScheduler creates scheduler which calls fetch for each saved
+// search. No more than concurrency fetches run at the same time.
+// Context of fetch is cancelled when scheduler is stopped
+func NewScheduler(searches *Searches,
+	fetch func(context.Context, string) error,
+	interval time.Duration, concurrency int) *Scheduler {
+	if searches == nil {
+		panic("NewScheduler(): passed nil searches")
+	}
+	if fetch == nil {
+		panic("NewScheduler(): passed nil fetch function")
+	}
+	if interval <= 0 || concurrency <= 0 {
+		panic("NewScheduler(): invalid interval or concurrency")
+	}
+	return &Scheduler{
+		searches: searches,
+		fetch:    fetch,
+		interval: interval,
+		sem:      make(chan struct{}, concurrency),
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		states:   make(map[string]*PollState),
+	}
+}
+
+// Start starts polling in background
+func (s *Scheduler) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stop != nil {
+		return errors.New("Scheduler is already running")
+	}
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go s.run(s.stop)
+	LogInfo("Scheduler start up")
+	return nil
+}
+
+// Stop stops polling and waits for running polls
+func (s *Scheduler) Stop() error {
+	s.mutex.Lock()
+	if s.stop == nil {
+		s.mutex.Unlock()
+		return errors.New("Scheduler is already stopped")
+	}
+	close(s.stop)
+	s.stop = nil
+	s.mutex.Unlock()
+	s.wg.Wait()
+	LogInfo("Scheduler shutdown")
+	return nil
+}
+
+func (s *Scheduler) run(stop chan struct{}) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(_SCHEDULER_TICK)
+	defer ticker.Stop()
+	// running polls are cancelled on stop
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+	for {
+		s.poll(ctx, stop)
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll starts polling of feeds which poll time has come
+func (s *Scheduler) poll(ctx context.Context, stop chan struct{}) {
+	now := time.Now()
+	for _, ss := range s.searches.List() {
+		s.mutex.Lock()
+		state, ok := s.states[ss.URL]
+		if !ok {
+			state = &PollState{URL: ss.URL}
+			s.states[ss.URL] = state
+		}
+		if state.running || now.Before(state.NextPoll) {
+			s.mutex.Unlock()
+			continue
+		}
+		state.running = true
+		s.mutex.Unlock()
+
+		s.wg.Add(1)
+		go func(ss *SavedSearch, state *PollState) {
+			defer s.wg.Done()
+			select {
+			case s.sem <- struct{}{}:
+			case <-stop:
+				s.mutex.Lock()
+				state.running = false
+				s.mutex.Unlock()
+				return
+			}
+			err := s.fetch(ctx, ss.URL)
+			<-s.sem
+			if ctx.Err() != nil {
+				// poll was cancelled by stop, it isn't failure of feed
+				s.mutex.Lock()
+				state.running = false
+				s.mutex.Unlock()
+				return
+			}
+			s.done(ss, state, err)
+		}(ss, state)
+	}
+}
+
+// done saves poll result and calculates next poll time
+func (s *Scheduler) done(ss *SavedSearch, state *PollState, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	state.running = false
+	state.LastPoll = now
+	delay := ss.PollInterval(s.interval)
+	if err != nil {
+		log.Println("Polling error:", err)
+		state.Failures++
+		state.LastError = err.Error()
+		// delay grows twice with each failure in a row
+		for i := 0; i < state.Failures; i++ {
+			if delay *= 2; delay >= _SCHEDULER_MAX_BACKOFF {
+				delay = _SCHEDULER_MAX_BACKOFF
+				break
+			}
+		}
+	} else {
+		state.Failures = 0
+		state.LastError = ""
+		state.LastSuccess = now
+	}
+	// jitter prevents polling of all feeds at the same moment
+	delay += time.Duration((s.rand.Float64()*2 - 1) *
+		_SCHEDULER_JITTER * float64(delay))
+	state.NextPoll = now.Add(delay)
+}
+
+// States returns copy of poll states of all feeds
+func (s *Scheduler) States() map[string]PollState {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	states := make(map[string]PollState, len(s.states))
+	for rawurl, state := range s.states {
+		states[rawurl] = *state
+	}
+	return states
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"net/url"
+	"strings"
+)
+
+var searchTmpl = template.Must(template.New("search").Funcs(template.FuncMap{
+	"law":   LawIdToString,
+	"price": FormatPrice,
+	"date":  RusFormatDate,
+	"link":  MakeLink,
+	"title": func(record *ArchiveRecord) string {
+		return MakeTitle(&record.Order)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="utf-8" />
+		<title>Поиск по архиву закупок</title>
+		<style>
+			body {font-family: sans-serif; font-size: 10pt;}
+			h1 {font-size: 15pt;}
+			form div {margin: 5px 0px;}
+			table {border-collapse: collapse; margin: 10px 0px;}
+			td, th {border: 1px solid #ccc; padding: 3px 8px; text-align: left;}
+			a {color: #000;}
+			a:hover {background-color: #444; color: #fff;}
+			s {color: #f00; text-decoration: none;}
+		</style>
+	</head>
+	<body>
+		<h1>Поиск по архиву закупок</h1>
+		<form method="get">
+			<div>
+				<input type="text" name="q" size="60" value="{{.Form.Get "q"}}" />
+			</div>
+			<div>
+				<label><input type="checkbox" name="law" value="44" {{if .Laws.FZ44}}checked{{end}} /> 44-ФЗ</label>
+				<label><input type="checkbox" name="law" value="223" {{if .Laws.FZ223}}checked{{end}} /> 223-ФЗ</label>
+				<label><input type="checkbox" name="law" value="94" {{if .Laws.FZ94}}checked{{end}} /> 94-ФЗ</label>
+			</div>
+			<div>
+				Цена от <input type="text" name="price_from" value="{{.Form.Get "price_from"}}" />
+				до <input type="text" name="price_to" value="{{.Form.Get "price_to"}}" />
+			</div>
+			<div>
+				Дата публикации с <input type="text" name="date_from" placeholder="дд.мм.гггг" value="{{.Form.Get "date_from"}}" />
+				по <input type="text" name="date_to" placeholder="дд.мм.гггг" value="{{.Form.Get "date_to"}}" />
+			</div>
+			<div><input type="submit" value="Найти" /></div>
+		</form>
+		{{if .Error}}
+			<div><s>{{.Error}}</s></div>
+		{{else if .Records}}
+			<table>
+				<tr>
+					<th>Закупка</th>
+					<th>Наименование</th>
+					<th>Организация</th>
+					<th>Цена</th>
+					<th>Опубликована</th>
+					<th>Окончание подачи заявок</th>
+				</tr>
+				{{range .Records}}
+					<tr>
+						<td>{{law .LawId}} <a href="{{link .OrderId}}">{{title .}}</a></td>
+						<td>{{.OrderName}}</td>
+						<td>{{.OrganisationName}}</td>
+						<td>{{price .StartOrderPrice}} {{.CurrencyId}}</td>
+						<td>{{date .PubDate}}</td>
+						<td>{{date .FinishFilingDate}}</td>
+					</tr>
+				{{end}}
+			</table>
+		{{else if .Form}}
+			<div>Ничего не найдено</div>
+		{{end}}
+	</body>
+</html>`))
+
+// ErrInvalidQuery is returned when search form contains invalid values
+type ErrInvalidQuery struct {
+	field string
+	err   error
+}
+
+func (e *ErrInvalidQuery) Error() string {
+	return "Invalid search parameter " + e.field + ": " + e.err.Error()
+}
+
+// ParseArchiveQuery creates archive query by search form values:
+// q, law, price_from, price_to, date_from and date_to
+func ParseArchiveQuery(form url.Values) (*ArchiveQuery, error) {
+	q := &ArchiveQuery{Text: form.Get("q")}
+
+	for _, str := range form["law"] {
+		law, err := ParseLow(str)
+		if err != nil {
+			return nil, &ErrInvalidQuery{"law", err}
+		}
+		q.Laws = append(q.Laws, law)
+	}
+
+	var err error
+	// price may be formated with spaces
+	if str := strings.Replace(form.Get("price_from"), " ", "", -1); len(str) > 0 {
+		if q.PriceFrom, err = ParsePrice(str); err != nil {
+			return nil, &ErrInvalidQuery{"price_from", err}
+		}
+	}
+	if str := strings.Replace(form.Get("price_to"), " ", "", -1); len(str) > 0 {
+		if q.PriceTo, err = ParsePrice(str); err != nil {
+			return nil, &ErrInvalidQuery{"price_to", err}
+		}
+	}
+	if str := form.Get("date_from"); len(str) > 0 {
+		if q.DateFrom, err = ParseRusFormatDate(str); err != nil {
+			return nil, &ErrInvalidQuery{"date_from", err}
+		}
+	}
+	if str := form.Get("date_to"); len(str) > 0 {
+		if q.DateTo, err = ParseRusFormatDate(str); err != nil {
+			return nil, &ErrInvalidQuery{"date_to", err}
+		}
+		// include whole last day
+		q.DateTo = q.DateTo.AddDate(0, 0, 1).Add(-1)
+	}
+
+	return q, nil
+}
+
+// WriteSearchPage writes html page with search form and found records
+func WriteSearchPage(w io.Writer, form url.Values,
+	records []*ArchiveRecord, searchErr error) error {
+	laws := make(map[string]bool)
+	for _, str := range form["law"] {
+		if law, err := ParseLow(str); err == nil {
+			switch law {
+			case FZ44:
+				laws["FZ44"] = true
+			case FZ223:
+				laws["FZ223"] = true
+			case FZ94:
+				laws["FZ94"] = true
+			}
+		}
+	}
+	return searchTmpl.Execute(w, map[string]interface{}{
+		"Form":    form,
+		"Laws":    laws,
+		"Records": records,
+		"Error":   searchErr,
+	})
+}
+
+// WriteSearchJSON writes found records as json array
+func WriteSearchJSON(w io.Writer, records []*ArchiveRecord) error {
+	if records == nil {
+		records = []*ArchiveRecord{}
+	}
+	return json.NewEncoder(w).Encode(records)
+}
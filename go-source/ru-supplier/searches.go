@@ -0,0 +1,558 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	_SEARCHES_FILE_NAME = "searches.json"
+	// suffix of temporary file which is renamed into searches file
+	_SEARCHES_TEMP_SUFFIX = ".tmp"
+	// prefix of generated slugs
+	_SEARCHES_SLUG_PREFIX = "search"
+)
+
+var (
+	ErrSearchNotFound = errors.New("Saved search not found")
+	ErrSearchExists   = errors.New("Saved search already exists")
+	ErrInvalidSlug    = errors.New("Invalid slug: only latin letters, " +
+		"digits, - and _ are allowed")
+)
+
+var searchesTmpl = template.Must(template.New("searches").Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="utf-8" />
+		<title>Сохраненные поиски</title>
+		<style>
+			body {font-family: sans-serif; font-size: 10pt;}
+			h1 {font-size: 15pt;}
+			h2 {font-size: 12pt; margin-top: 25px;}
+			form div {margin: 5px 0px;}
+			table {border-collapse: collapse; margin: 10px 0px;}
+			td, th {border: 1px solid #ccc; padding: 3px 8px; text-align: left;}
+			td form {display: inline;}
+			a {color: #000;}
+			a:hover {background-color: #444; color: #fff;}
+			s {color: #f00; text-decoration: none;}
+		</style>
+	</head>
+	<body>
+		<h1>Сохраненные поиски</h1>
+		{{if .Error}}
+			<div><s>{{.Error}}</s></div>
+		{{end}}
+		{{if .Searches}}
+			<div>Все поиски одной лентой: <a href="{{.AllLink}}">{{.AllLink}}</a></div>
+			<table>
+				<tr>
+					<th>Название</th>
+					<th>Лента</th>
+					<th>Фильтр</th>
+					<th>Интервал, мин</th>
+					<th>Группы</th>
+					<th></th>
+				</tr>
+				{{range .Searches}}
+					<tr>
+						<td><a href="{{.URL}}">{{.Name}}</a></td>
+						<td><a href="{{.FeedLink}}">{{.FeedLink}}</a></td>
+						<td>{{if .Filter}}{{.Filter}}{{else}}основной{{end}}</td>
+						<td>{{if .Interval}}{{.Interval}}{{else}}по умолчанию{{end}}</td>
+						<td>
+							{{range .GroupLinks}}
+								<a href="{{.Link}}">{{.Name}}</a>
+							{{end}}
+						</td>
+						<td>
+							<form method="post">
+								<input type="hidden" name="{{$.CSRF.Param}}" value="{{$.CSRF.Token}}" />
+								<input type="hidden" name="action" value="delete" />
+								<input type="hidden" name="slug" value="{{.Slug}}" />
+								<input type="submit" value="Удалить" />
+							</form>
+						</td>
+					</tr>
+				{{end}}
+			</table>
+		{{else}}
+			<div>Сохраненных поисков нет</div>
+		{{end}}
+		<h2>Добавить или изменить поиск</h2>
+		<form method="post">
+			<input type="hidden" name="{{$.CSRF.Param}}" value="{{$.CSRF.Token}}" />
+			<input type="hidden" name="action" value="save" />
+			<div>Название <input type="text" name="name" size="40" /></div>
+			<div>Имя ленты <input type="text" name="slug" size="20" placeholder="латиница, цифры, - и _" /></div>
+			<div>Ссылка на csv <input type="text" name="url" size="80" /></div>
+			<fieldset>
+				<legend>или параметры поиска, если ссылка не указана</legend>
+				<div>
+					Ключевые слова <input type="text" name="keywords" size="40" />
+					<label><input type="checkbox" name="morphology" value="1" /> морфология</label>
+				</div>
+				<div>
+					Законы
+					{{range .Laws}}
+						<label><input type="checkbox" name="law" value="{{.Code}}" /> {{.Name}}</label>
+					{{end}}
+				</div>
+				<div>
+					Начальная цена, руб. от <input type="text" name="price_from" size="12" />
+					до <input type="text" name="price_to" size="12" />
+				</div>
+				<div>
+					Этапы
+					{{range .Stages}}
+						<label><input type="checkbox" name="stage" value="{{.Code}}" /> {{.Name}}</label>
+					{{end}}
+				</div>
+				<div>
+					Дата размещения с <input type="text" name="publish_from" size="10" placeholder="ДД.ММ.ГГГГ" />
+					по <input type="text" name="publish_to" size="10" placeholder="ДД.ММ.ГГГГ" />
+				</div>
+				<div>Заказчик <input type="text" name="customer" size="40" /></div>
+				<div>Регионы <input type="text" name="regions" size="40" placeholder="коды регионов через запятую" /></div>
+				<div><label><input type="checkbox" name="extended" value="1" /> расширенный поиск</label></div>
+			</fieldset>
+			<div>Профиль фильтра <input type="text" name="filter" size="20" /></div>
+			<div>Интервал опроса, мин <input type="text" name="interval" size="5" /></div>
+			<div>Группы <input type="text" name="groups" size="40" placeholder="через запятую" /></div>
+			<div><input type="submit" value="Сохранить" /></div>
+		</form>
+		<h2>Импорт и экспорт</h2>
+		<div><a href="{{.OPMLLink}}">Скачать все ленты в формате OPML</a></div>
+		<form method="post" action="{{.OPMLImportLink}}" enctype="multipart/form-data">
+			<input type="hidden" name="{{$.CSRF.Param}}" value="{{$.CSRF.Token}}" />
+			<div>
+				Импорт лент /rss?url= из OPML
+				<input type="file" name="file" />
+				<input type="submit" value="Импортировать" />
+			</div>
+		</form>
+	</body>
+</html>`))
+
+// ErrInvalidSearch is returned when saved search has invalid field
+type ErrInvalidSearch struct {
+	err error
+}
+
+func (e *ErrInvalidSearch) Error() string {
+	return "Invalid saved search: " + e.err.Error()
+}
+
+var slugExp = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+// Slugs of merged feeds which cannot be used by saved searches
+var reservedSlugs = map[string]bool{
+	_AGGREGATE_ALL_SLUG:   true,
+	_AGGREGATE_GROUP_SLUG: true,
+}
+
+// SavedSearch is zakupki search which is polled by scheduler and is
+// available by short feed url
+type SavedSearch struct {
+	Name     string   // feed title
+	Slug     string   // feed path name
+	URL      string   // url of csv stream
+	Filter   string   // filter profile name, empty for default filter
+	Interval int      // poll interval in minutes, zero for default
+	Groups   []string // groups of merged feeds /feed/group/<group>
+	// search params, if query is set url is made by query
+	Query *SearchQuery `json:",omitempty"`
+}
+
+// normalize makes url by query if query is set and normalizes url
+// otherwise, so saved search and /rss?url= link of the same search
+// share one feed. Invalid url is kept for Verify
+func (ss *SavedSearch) normalize() {
+	if ss.Query != nil {
+		ss.URL = ss.Query.URL()
+	} else if feedURL, err := FeedURL(ss.URL); err == nil {
+		ss.URL = feedURL
+	}
+}
+
+// PollInterval returns poll interval of search or def if interval is
+// not defined
+func (ss *SavedSearch) PollInterval(def time.Duration) time.Duration {
+	if ss.Interval > 0 {
+		return time.Duration(ss.Interval) * time.Minute
+	}
+	return def
+}
+
+// Verify checks saved search fields
+func (ss *SavedSearch) Verify() error {
+	if !slugExp.MatchString(ss.Slug) {
+		return &ErrInvalidSearch{ErrInvalidSlug}
+	}
+	if reservedSlugs[ss.Slug] {
+		return &ErrInvalidSearch{
+			fmt.Errorf("Slug %q is reserved", ss.Slug),
+		}
+	}
+	if ss.Query != nil {
+		if err := ss.Query.Verify(); err != nil {
+			return &ErrInvalidSearch{err}
+		}
+	}
+	if _, err := ParseSearchURL(ss.URL); err != nil {
+		return &ErrInvalidSearch{err}
+	}
+	if len(ss.Filter) > 0 && !slugExp.MatchString(ss.Filter) {
+		return &ErrInvalidSearch{
+			errors.New("Invalid filter profile name"),
+		}
+	}
+	if ss.Interval < 0 {
+		return &ErrInvalidSearch{errors.New("Invalid poll interval")}
+	}
+	for _, group := range ss.Groups {
+		if !slugExp.MatchString(group) {
+			return &ErrInvalidSearch{
+				fmt.Errorf("Invalid group name %q", group),
+			}
+		}
+	}
+	return nil
+}
+
+// MakeSlug makes slug by passed name. MakeSlug keeps only latin
+// letters and digits
+func MakeSlug(name string) string {
+	var slug []rune
+	for _, r := range strings.ToLower(name) {
+		if r < 128 && slugExp.MatchString(string(r)) {
+			slug = append(slug, r)
+		} else if len(slug) > 0 && slug[len(slug)-1] != '-' {
+			slug = append(slug, '-')
+		}
+	}
+	return strings.Trim(string(slug), "-")
+}
+
+// Searches stores saved searches in json file fname. Searches is safe
+// for concurrent use
+type Searches struct {
+	mutex     sync.RWMutex // guards list
+	fileMutex sync.Mutex   // serializes file writing
+	fname     string
+	list      []*SavedSearch
+}
+
+func LoadSearches(fname string) (searches *Searches, err error) {
+	if len(fname) == 0 {
+		panic("Searches: invalid file name")
+	}
+
+	searches = &Searches{fname: fname}
+
+	var file *os.File
+	file, err = os.Open(fname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer file.Close()
+
+	var list []*SavedSearch
+	if err = json.NewDecoder(file).Decode(&list); err != nil {
+		if err == io.EOF {
+			err = nil
+		}
+		return
+	}
+
+	for _, ss := range list {
+		if ss == nil {
+			continue
+		}
+		if ss.normalize(); len(ss.URL) == 0 {
+			continue
+		}
+		if len(ss.Slug) == 0 {
+			ss.Slug = searches.freeSlug(ss.Name)
+		}
+		if errVerify := ss.Verify(); errVerify != nil {
+			err = fmt.Errorf("skip %q: %s", ss.Name, errVerify)
+			continue
+		}
+		if searches.find(ss.Slug) > -1 {
+			err = fmt.Errorf("skip %q: %s", ss.Name, ErrSearchExists)
+			continue
+		}
+		searches.list = append(searches.list, ss)
+	}
+
+	return
+}
+
+// Save writes saved searches into temporary file and renames it into
+// searches file
+func (s *Searches) Save() error {
+	s.fileMutex.Lock()
+	defer s.fileMutex.Unlock()
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	tmpname := s.fname + _SEARCHES_TEMP_SUFFIX
+	file, err := os.Create(tmpname)
+	if err != nil {
+		return err
+	}
+	list := s.list
+	if list == nil {
+		list = []*SavedSearch{}
+	}
+	if err = json.NewEncoder(file).Encode(list); err == nil {
+		err = file.Sync()
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(tmpname)
+		return err
+	}
+	return os.Rename(tmpname, s.fname)
+}
+
+// find returns index of saved search with passed slug or -1. Mutex
+// must be locked
+func (s *Searches) find(slug string) int {
+	for i, ss := range s.list {
+		if ss.Slug == slug {
+			return i
+		}
+	}
+	return -1
+}
+
+// freeSlug makes unused slug by name. Mutex must be locked
+func (s *Searches) freeSlug(name string) string {
+	base := MakeSlug(name)
+	if len(base) == 0 {
+		base = _SEARCHES_SLUG_PREFIX
+	}
+	slug := base
+	for i := 2; s.find(slug) > -1 || reservedSlugs[slug]; i++ {
+		slug = base + "-" + strconv.Itoa(i)
+	}
+	return slug
+}
+
+// List returns copy of saved searches list
+func (s *Searches) List() []*SavedSearch {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	list := make([]*SavedSearch, len(s.list))
+	for i, ss := range s.list {
+		ssCopy := *ss
+		list[i] = &ssCopy
+	}
+	return list
+}
+
+// Get returns copy of saved search with passed slug
+func (s *Searches) Get(slug string) (*SavedSearch, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if i := s.find(slug); i > -1 {
+		ssCopy := *s.list[i]
+		return &ssCopy, nil
+	}
+	return nil, ErrSearchNotFound
+}
+
+// Contains returns true if there is saved search with url rawurl
+func (s *Searches) Contains(rawurl string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, ss := range s.list {
+		if ss.URL == rawurl {
+			return true
+		}
+	}
+	return false
+}
+
+// GetByURL returns copy of saved search with url rawurl
+func (s *Searches) GetByURL(rawurl string) (*SavedSearch, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, ss := range s.list {
+		if ss.URL == rawurl {
+			ssCopy := *ss
+			return &ssCopy, nil
+		}
+	}
+	return nil, ErrSearchNotFound
+}
+
+// Add adds saved search and saves list. If slug is empty it is made
+// by name
+func (s *Searches) Add(ss *SavedSearch) error {
+	s.mutex.Lock()
+	ssCopy := *ss
+	ssCopy.normalize()
+	if len(ssCopy.Slug) == 0 {
+		ssCopy.Slug = s.freeSlug(ssCopy.Name)
+	}
+	if err := ssCopy.Verify(); err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	if s.find(ssCopy.Slug) > -1 {
+		s.mutex.Unlock()
+		return ErrSearchExists
+	}
+	s.list = append(s.list, &ssCopy)
+	*ss = ssCopy
+	s.mutex.Unlock()
+	return s.Save()
+}
+
+// Update replaces saved search with passed slug and saves list
+func (s *Searches) Update(slug string, ss *SavedSearch) error {
+	s.mutex.Lock()
+	i := s.find(slug)
+	if i == -1 {
+		s.mutex.Unlock()
+		return ErrSearchNotFound
+	}
+	ssCopy := *ss
+	ssCopy.normalize()
+	if len(ssCopy.Slug) == 0 {
+		ssCopy.Slug = slug
+	}
+	if err := ssCopy.Verify(); err != nil {
+		s.mutex.Unlock()
+		return err
+	}
+	if j := s.find(ssCopy.Slug); j > -1 && j != i {
+		s.mutex.Unlock()
+		return ErrSearchExists
+	}
+	s.list[i] = &ssCopy
+	*ss = ssCopy
+	s.mutex.Unlock()
+	return s.Save()
+}
+
+// Remove removes saved search with passed slug and saves list
+func (s *Searches) Remove(slug string) error {
+	s.mutex.Lock()
+	i := s.find(slug)
+	if i == -1 {
+		s.mutex.Unlock()
+		return ErrSearchNotFound
+	}
+	s.list = append(s.list[:i], s.list[i+1:]...)
+	s.mutex.Unlock()
+	return s.Save()
+}
+
+// WriteSearchesPage writes html page with saved searches and form for
+// saved search editing. Links are made with public url base, forms
+// contain token csrf
+func WriteSearchesPage(w io.Writer, base string, list []*SavedSearch,
+	csrf string, pageErr error) error {
+	type groupLink struct {
+		Name, Link string
+	}
+	type searchView struct {
+		*SavedSearch
+		FeedLink   string
+		GroupLinks []*groupLink
+	}
+	views := make([]*searchView, len(list))
+	for i, ss := range list {
+		views[i] = &searchView{ss, MakeFeedLink(ss.Slug, base), nil}
+		for _, group := range ss.Groups {
+			views[i].GroupLinks = append(views[i].GroupLinks, &groupLink{
+				group, MakeFeedLink(_AGGREGATE_GROUP_SLUG+"/"+group, base),
+			})
+		}
+	}
+	return searchesTmpl.Execute(w, map[string]interface{}{
+		"Searches":       views,
+		"AllLink":        MakeFeedLink(_AGGREGATE_ALL_SLUG, base),
+		"Error":          pageErr,
+		"OPMLLink":       base + _PATH_TO_OPML,
+		"OPMLImportLink": base + _PATH_TO_OPML_IMPORT,
+		"Laws":           queryOptions(searchLaws),
+		"Stages":         queryOptions(searchStages),
+		"CSRF": map[string]string{
+			"Param": _DASHBOARD_CSRF_PARAM,
+			"Token": csrf,
+		},
+	})
+}
+
+type queryOption struct {
+	Code, Name string
+}
+
+// queryOptions returns options of search param sorted by code
+func queryOptions(names map[string]string) []*queryOption {
+	options := make([]*queryOption, 0, len(names))
+	for code, name := range names {
+		options = append(options, &queryOption{code, name})
+	}
+	sort.Sort(queryOptionsByCode(options))
+	return options
+}
+
+type queryOptionsByCode []*queryOption
+
+func (s queryOptionsByCode) Len() int           { return len(s) }
+func (s queryOptionsByCode) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s queryOptionsByCode) Less(i, j int) bool { return s[i].Code < s[j].Code }
+
+// ParseSavedSearchForm creates saved search by form values: name, slug,
+// url, filter, interval and comma separated groups. If url is empty,
+// search params are read by ParseSearchQueryForm
+func ParseSavedSearchForm(form url.Values) (*SavedSearch, error) {
+	ss := &SavedSearch{
+		Name:   strings.TrimSpace(form.Get("name")),
+		Slug:   strings.TrimSpace(form.Get("slug")),
+		URL:    strings.TrimSpace(form.Get("url")),
+		Filter: strings.TrimSpace(form.Get("filter")),
+	}
+	for _, group := range strings.Split(form.Get("groups"), ",") {
+		if group = strings.TrimSpace(group); len(group) > 0 {
+			ss.Groups = append(ss.Groups, group)
+		}
+	}
+	if str := strings.TrimSpace(form.Get("interval")); len(str) > 0 {
+		interval, err := strconv.Atoi(str)
+		if err != nil {
+			return nil, &ErrInvalidSearch{err}
+		}
+		ss.Interval = interval
+	}
+	if len(ss.URL) == 0 {
+		query, err := ParseSearchQueryForm(form)
+		if err != nil {
+			return nil, &ErrInvalidSearch{err}
+		}
+		ss.Query = query
+	}
+	return ss, nil
+}
@@ -1,58 +1,195 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"io"
 	"log"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
 const (
-	_PATH_TO_RSS         = "/rss"
-	_PATH_TO_SHORT_LINKS = "/open"
+	_PATH_TO_RSS          = "/rss"
+	_PATH_TO_SHORT_LINKS  = "/open"
+	_PATH_TO_DIAGNOSTICS  = "/diagnostics"
+	_PATH_TO_SEARCH       = "/search"
+	_PATH_TO_FEEDS        = "/feed"
+	_PATH_TO_SEARCHES     = "/searches"
+	_PATH_TO_SEARCH_API   = "/api/searches"
+	_PATH_TO_OPML         = "/opml"
+	_PATH_TO_OPML_IMPORT  = "/opml/import"
+	_PATH_TO_EVENTS       = "/events"
+	_PATH_TO_DEAD_API     = "/api/webhooks/dead"
+	_PATH_TO_STARS_API    = "/api/stars"
+	_PATH_TO_DASHBOARD    = "/"
+	_PATH_TO_DOCS         = "/docs"
+	_PATH_TO_GENERATE     = "/generate"
+	_PATH_TO_GENERATE_API = "/api/generate"
+	_PATH_TO_DECODE       = "/decode"
+	_PATH_TO_DECODE_API   = "/api/decode"
+	_PATH_TO_HEALTHZ      = "/healthz"
+	_PATH_TO_READYZ       = "/readyz"
+	_PATH_TO_METRICS      = "/metrics"
 )
 
 // RSS protocol required port 80
 const _RSS_REQUIRED_PORT = "80"
 
+// Header which api clients send with state-changing requests. Browser
+// doesn't send custom headers to other sites without preflight request
+const _API_REQUEST_HEADER = "X-Ru-Supplier-Request"
+
+// Timeout of graceful shutdown, connections which are still open after
+// timeout are closed
+const _SHUTDOWN_TIMEOUT = 10 * time.Second
+
 type ZakupkiProxyServer interface {
 	Start() error
 	ShutDown() error
 	IsRunning() bool
 	RemoveCache() error
+	// ExitRequested returns channel which is closed when user asks to
+	// exit from the dashboard
+	ExitRequested() <-chan struct{}
 }
 
 type Server struct {
 	*http.ServeMux
 	*sync.WaitGroup
-	reader OrderParserReader
-	filter OrderFilter
-	config ServerConfig
-	lis    net.Listener
+	reader    OrderParserReader
+	diag      *Diagnostics
+	metrics   *Metrics
+	archive   *Archive
+	fetches   *FetchGroup
+	searches  *Searches
+	scheduler *Scheduler
+	profiles  *FilterProfiles
+	events    *EventHub
+	webhooks  *Webhooks
+	digests   *Digests
+	stars     *Stars
+	notifiers []Notifier
+	alerters  []Alerter
+	auth      *Auth
+	csrfToken string // token of dashboard forms
+	config    ServerConfig
+	lis       net.Listener
+	http      *http.Server
+	// ctx is base context of requests, it is cancelled on shutdown, so
+	// upstream fetches of processed requests are cancelled
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started time.Time
+	// proxy is paused from dashboard: background services are stopped
+	// and feeds are not served, but dashboard is available
+	paused     bool
+	pauseMutex sync.Mutex
+	exit       chan struct{}
+	exitOnce   sync.Once
 }
 
-func NewServer(config ServerConfig, filter OrderFilter) (s *Server) {
+func NewServer(config ServerConfig, filter OrderFilter,
+	archive *Archive, searches *Searches, dead *DeadLetters) (s *Server) {
 	if config == nil {
 		panic("Server: passed nil config")
 	}
 	if filter == nil {
 		panic("Server: passed nil filter")
 	}
+	if archive == nil {
+		panic("Server: passed nil archive")
+	}
+	if searches == nil {
+		panic("Server: passed nil searches")
+	}
+	if dead == nil {
+		panic("Server: passed nil dead letters")
+	}
+
+	diag := NewDiagnostics(_DIAGNOSTICS_ROWS_LIMIT)
+	events := NewEventHub()
+	webhooks := NewWebhooks(config.GetWebhooks(), dead)
 
 	s = &Server{
 		http.NewServeMux(),
 		&sync.WaitGroup{},
-		NewOrderReader(),
-		filter,
+		NewOrderReader(diag, config.GetCacheFile()),
+		diag,
+		NewMetrics(),
+		archive,
+		NewFetchGroup(),
+		searches,
+		nil,
+		NewFilterProfiles(filter, config.GetFilterProfilesDir()),
+		events,
+		webhooks,
+		nil,
+		nil,
+		[]Notifier{events, webhooks},
+		[]Alerter{events, webhooks},
+		NewAuth(config.GetUsers()),
+		NewCSRFToken(),
 		config,
 		nil,
+		nil,
+		nil,
+		nil,
+		time.Time{},
+		false,
+		sync.Mutex{},
+		make(chan struct{}),
+		sync.Once{},
+	}
+
+	s.scheduler = NewScheduler(searches, s.fetch,
+		config.GetPollInterval(), config.GetPollConcurrency())
+
+	var mailer *Mailer
+	if smtpConfig := config.GetSMTP(); smtpConfig != nil {
+		mailer = NewMailer(smtpConfig)
+	}
+	s.digests = NewDigests(config.GetDigests(), mailer, archive, searches,
+		s.filterItems)
+	s.notifiers = append(s.notifiers, s.digests)
+	if to := config.GetStarAlertsTo(); len(to) > 0 && mailer != nil {
+		s.alerters = append(s.alerters, NewMailAlerter(mailer, to))
 	}
+	s.stars = NewStars(archive, config.GetStarReminders(), s.FetchOrder,
+		s.alert)
 
 	s.HandleFunc(_PATH_TO_RSS, s.RSSHandler)
 	s.HandleFunc(_PATH_TO_SHORT_LINKS, s.ShortLinkHandler)
+	s.HandleFunc(_PATH_TO_DIAGNOSTICS, s.DiagnosticsHandler)
+	s.HandleFunc(_PATH_TO_SEARCH, s.SearchHandler)
+	s.HandleFunc(_PATH_TO_FEEDS+"/", s.FeedHandler)
+	s.HandleFunc(_PATH_TO_SEARCHES, s.SearchesPageHandler)
+	s.HandleFunc(_PATH_TO_SEARCH_API, s.SearchesAPIHandler)
+	s.HandleFunc(_PATH_TO_SEARCH_API+"/", s.SearchesAPIHandler)
+	s.HandleFunc(_PATH_TO_OPML, s.OPMLHandler)
+	s.HandleFunc(_PATH_TO_OPML_IMPORT, s.OPMLImportHandler)
+	s.HandleFunc(_PATH_TO_EVENTS, s.EventsHandler)
+	s.HandleFunc(_PATH_TO_DEAD_API, s.DeadLettersHandler)
+	s.HandleFunc(_PATH_TO_STARS_API, s.StarsAPIHandler)
+	s.HandleFunc(_PATH_TO_DASHBOARD, s.DashboardHandler)
+	s.HandleFunc(_PATH_TO_GENERATE, s.GenerateHandler)
+	s.HandleFunc(_PATH_TO_GENERATE_API, s.GenerateAPIHandler)
+	s.HandleFunc(_PATH_TO_DECODE, s.DecodeHandler)
+	s.HandleFunc(_PATH_TO_DECODE_API, s.DecodeAPIHandler)
+	s.HandleFunc(_PATH_TO_HEALTHZ, s.HealthHandler)
+	s.HandleFunc(_PATH_TO_READYZ, s.ReadyHandler)
+	s.HandleFunc(_PATH_TO_METRICS, s.MetricsHandler)
+	s.Handle(_PATH_TO_DOCS+"/", http.StripPrefix(_PATH_TO_DOCS+"/",
+		http.FileServer(http.Dir(config.GetDocsDir()))))
 
 	return s
 }
@@ -62,9 +199,22 @@ func (s *Server) Start() (err error) {
 		return errors.New("Server is already running")
 	}
 
-	if s.config.GetPort() != _RSS_REQUIRED_PORT {
+	tlsConfig := s.config.GetTLS()
+	if tlsConfig == nil && s.config.GetPort() != _RSS_REQUIRED_PORT {
 		log.Println("RSS protocol required port 80")
 	}
+	if tlsConfig == nil && s.auth.Enabled() {
+		log.Println("Passwords and tokens are sent without encryption," +
+			" set TLS in config")
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.http = &http.Server{
+		Handler: s,
+		BaseContext: func(net.Listener) context.Context {
+			return s.ctx
+		},
+	}
 
 	s.lis, err = net.Listen("tcp",
 		s.config.GetHost()+":"+s.config.GetPort())
@@ -73,28 +223,256 @@ func (s *Server) Start() (err error) {
 		log.Fatal("Server:", err)
 	}
 
-	log.Println("Server start up")
+	if tlsConfig != nil {
+		var cert tls.Certificate
+		cert, err = tlsConfig.LoadCertificate(s.config.GetDataDir(),
+			s.certificateHosts())
+		if err != nil {
+			s.lis.Close()
+			s.lis = nil
+			return errors.New("Cannot load certificate: " + err.Error())
+		}
+		s.lis = tls.NewListener(s.lis, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+		})
+	}
+
+	LogInfo("Server start up")
+	s.started = time.Now()
+
+	s.pauseMutex.Lock()
+	if !s.paused {
+		s.startServices()
+	}
+	s.pauseMutex.Unlock()
 
-	return http.Serve(s.lis, s)
+	if err = s.http.Serve(s.lis); err == http.ErrServerClosed {
+		err = nil
+	}
+	return
 }
 
-func (s *Server) ShutDown() error {
-	if s.lis == nil {
-		return errors.New("Server is already stopped")
+// certificateHosts returns hosts of self-signed certificate: listen host
+// and host of public url
+func (s *Server) certificateHosts() []string {
+	hosts := []string{s.config.GetHost()}
+	if URL, err := url.Parse(s.config.GetBaseURL()); err == nil {
+		if host := URL.Host; len(host) > 0 {
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			if host != hosts[0] {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+	return hosts
+}
+
+// ServeHTTP authenticates request if users are set in config and
+// serves it
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.auth.Required(r.URL.Path) && s.auth.Authenticate(r) == nil {
+		s.auth.Deny(w)
+		r.Body.Close()
+		return
+	}
+	s.ServeMux.ServeHTTP(w, r)
+}
+
+// accessToken returns access token which is added to links for request
+// authenticated user
+func (s *Server) accessToken(r *http.Request) string {
+	if !s.auth.Enabled() {
+		return ""
+	}
+	if user := s.auth.Authenticate(r); user != nil {
+		return user.Token
+	}
+	return ""
+}
+
+// subscriber returns identity of rss client which receives orders with
+// own delivery cursor. Client is identified by access token in feed
+// link: by owner of token if authentication is enabled or by token
+// itself otherwise. Client without token has no identity
+func (s *Server) subscriber(r *http.Request) string {
+	token := r.URL.Query().Get(_AUTH_TOKEN_PARAM)
+	if len(token) == 0 {
+		return ""
+	}
+	if s.auth.Enabled() {
+		if user := s.auth.TokenUser(token); user != nil {
+			return "user:" + user.Name
+		}
+		return ""
+	}
+	return "token:" + token
+}
+
+// validRequest checks that state-changing request isn't sent by html
+// form or script of other site from browser of user. Browser sends such
+// requests without preflight only with simple content type and without
+// custom headers, so these requests must contain token of proxy forms
+func (s *Server) validRequest(r *http.Request) bool {
+	if len(r.Header.Get(_API_REQUEST_HEADER)) > 0 {
+		return true
+	}
+	mediatype, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err == nil {
+		switch mediatype {
+		case "application/x-www-form-urlencoded", "multipart/form-data",
+			"text/plain":
+		default:
+			return true
+		}
+	}
+	return equalSecrets(r.FormValue(_DASHBOARD_CSRF_PARAM), s.csrfToken)
+}
+
+// startServices starts background polling and notifications
+func (s *Server) startServices() {
+	if err := s.webhooks.Start(); err != nil {
+		log.Println("Cannot start webhooks:", err)
+	}
+	if err := s.digests.Start(); err != nil {
+		log.Println("Cannot start digests:", err)
+	}
+	if err := s.stars.Start(); err != nil {
+		log.Println("Cannot start stars:", err)
+	}
+	if err := s.scheduler.Start(); err != nil {
+		log.Println("Cannot start scheduler:", err)
+	}
+}
+
+// stopServices stops background polling and notifications
+func (s *Server) stopServices() {
+	if err := s.scheduler.Stop(); err != nil {
+		log.Println("Cannot stop scheduler:", err)
+	}
+	// after scheduler, so webhooks don't receive new orders
+	if err := s.webhooks.Stop(); err != nil {
+		log.Println("Cannot stop webhooks:", err)
+	}
+	if err := s.digests.Stop(); err != nil {
+		log.Println("Cannot stop digests:", err)
+	}
+	if err := s.stars.Stop(); err != nil {
+		log.Println("Cannot stop stars:", err)
+	}
+	// finish event streams, otherwise they are never finished
+	s.events.Disconnect()
+}
+
+// Pause stops background services and serving of feeds, dashboard is
+// still available
+func (s *Server) Pause() error {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+	if s.paused {
+		return errors.New("Server is already paused")
 	}
+	s.stopServices()
+	s.paused = true
+	LogInfo("Server paused")
+	return nil
+}
+
+// Resume starts services which were stopped by Pause
+func (s *Server) Resume() error {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+	if !s.paused {
+		return errors.New("Server is not paused")
+	}
+	s.startServices()
+	s.paused = false
+	LogInfo("Server resumed")
+	return nil
+}
+
+func (s *Server) IsPaused() bool {
+	s.pauseMutex.Lock()
+	defer s.pauseMutex.Unlock()
+	return s.paused
+}
+
+// Exit asks interface to exit from program
+func (s *Server) Exit() {
+	s.exitOnce.Do(func() {
+		close(s.exit)
+	})
+}
 
-	s.Wait() // wait for all processed requests
+func (s *Server) ExitRequested() <-chan struct{} {
+	return s.exit
+}
 
+// unavailable writes error and returns true if server is paused
+func (s *Server) unavailable(w http.ResponseWriter) bool {
+	if s.IsPaused() {
+		http.Error(w, "Proxy is stopped", http.StatusServiceUnavailable)
+		return true
+	}
+	return false
+}
+
+func (s *Server) ShutDown() error {
 	if s.lis == nil {
-		return nil
+		return errors.New("Server is already stopped")
 	}
 
-	log.Println("Server shutdown")
+	// processed requests stop waiting for upstream
+	s.cancel()
+
+	LogInfo("Server shutdown")
 
 	defer func() {
 		s.lis = nil
 	}()
-	return s.lis.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(),
+		_SHUTDOWN_TIMEOUT)
+	defer cancel()
+
+	// background services are stopped together with http server under
+	// the same timeout: webhooks and mails may wait for slow servers
+	stopped := make(chan struct{})
+	go func() {
+		s.pauseMutex.Lock()
+		if !s.paused {
+			s.stopServices()
+		}
+		s.pauseMutex.Unlock()
+		close(stopped)
+	}()
+
+	// listener is closed at once, idle connections are closed when
+	// processed requests are finished
+	err := s.http.Shutdown(ctx)
+	if err != nil {
+		log.Println("Server: shutdown timeout is exceeded:", err)
+		err = s.http.Close()
+	}
+
+	// wait for all processed requests, but no longer than timeout
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Println("Server: requests are still processed after shutdown")
+	}
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		log.Println("Server: services are still stopped after shutdown")
+	}
+	return err
 }
 
 func (s *Server) RemoveCache() error {
@@ -108,61 +486,1145 @@ func (s *Server) IsRunning() bool {
 func (s *Server) RSSHandler(w http.ResponseWriter, r *http.Request) {
 	s.Add(1) // signal that yet another request is processed
 
+	// signal that request was processed
+	defer s.Done()
 	defer r.Body.Close()
 
-	var orders []*Order
+	if s.unavailable(w) {
+		return
+	}
+
+	rawurl, err := FeedURL(r.FormValue("url"))
+	if err != nil {
+		http.Error(w, "Invalid feed url: "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
 
-	if resp, err := Load(r.FormValue("url")); err != nil {
-		log.Println("Loading error:", err)
+	// call feed like search request
+	var title string
+	if URL, err := url.Parse(rawurl); err == nil {
+		title = URL.Query().Get("searchString")
 	} else {
-		defer resp.Body.Close()
-		if resp.StatusCode != 200 {
-			log.Println("Server return status " + resp.Status)
+		log.Println("Getting feed title error:", err)
+	}
+
+	s.serveFeed(w, r, rawurl, title, s.profiles.Get(""))
+}
+
+// FeedHandler serves feed of saved search by its slug, merged feed of
+// all saved searches /feed/all and merged feeds of saved search groups
+// /feed/group/<group>
+func (s *Server) FeedHandler(w http.ResponseWriter, r *http.Request) {
+	s.Add(1) // signal that yet another request is processed
+
+	// signal that request was processed
+	defer s.Done()
+	defer r.Body.Close()
+
+	if s.unavailable(w) {
+		return
+	}
+
+	slug := strings.TrimPrefix(r.URL.Path, _PATH_TO_FEEDS+"/")
+
+	switch {
+	case slug == _AGGREGATE_ALL_SLUG:
+		s.serveMergedFeed(w, r, slug, _AGGREGATE_ALL_TITLE,
+			s.searches.List())
+	case strings.HasPrefix(slug, _AGGREGATE_GROUP_SLUG+"/"):
+		group := strings.TrimPrefix(slug, _AGGREGATE_GROUP_SLUG+"/")
+		if list := GroupSearches(s.searches.List(), group); len(list) > 0 {
+			s.serveMergedFeed(w, r, slug, _AGGREGATE_GROUP_TITLE+group,
+				list)
 		} else {
-			orders, err = s.reader.ReadOrders(resp)
-			if err != nil && err != io.EOF {
-				log.Println("Can't read or parse response: ", err)
-			}
+			http.NotFound(w, r)
 		}
+	default:
+		if ss, err := s.searches.Get(slug); err != nil {
+			http.NotFound(w, r)
+		} else {
+			s.serveFeed(w, r, ss.URL, ss.Name, s.profiles.Get(ss.Filter))
+		}
+	}
+}
 
-		log.Printf("Loaded %d orders\n", len(orders))
+// serveFeed writes feed with url rawurl filtered by filter
+func (s *Server) serveFeed(w http.ResponseWriter, r *http.Request,
+	rawurl, title string, filter OrderFilter) {
+	orders := s.feedOrders(r.Context(), rawurl, s.subscriber(r), filter)
+	s.writeFeed(w, s.accessToken(r), title, orders, nil)
+}
+
+// serveMergedFeed writes feed with orders of all passed saved searches.
+// Each order is noted with names of searches which have found it
+func (s *Server) serveMergedFeed(w http.ResponseWriter, r *http.Request,
+	slug, title string, list []*SavedSearch) {
+	// merged feed has own delivery cursors
+	subscriber := s.subscriber(r)
+	if len(subscriber) > 0 {
+		subscriber += "@" + slug
+	}
+	// merged feed is limited like feed of one search
+	limit, _ := s.config.GetFeedWindow()
+	if limit <= 0 {
+		limit = _FEED_DELIVERY_LIMIT
+	}
+	if len(subscriber) > 0 {
+		orders, searches := s.deliverMerged(list, subscriber, limit)
+		s.writeFeed(w, s.accessToken(r), title, orders, searches)
+		return
+	}
+	merger := NewMerger()
+	for _, ss := range list {
+		merger.Add(ss.Name, s.feedOrders(r.Context(), ss.URL, subscriber,
+			s.profiles.Get(ss.Filter)))
+	}
+	orders, searches := merger.Orders(limit)
+	s.writeFeed(w, s.accessToken(r), title, orders, searches)
+}
 
+// deliverMerged returns at most limit of the oldest orders of passed
+// saved searches which were not served to subscriber and names of
+// searches by order key. Cursors of searches are moved only past
+// returned orders and orders removed by filters, the rest of orders are
+// served next time
+func (s *Server) deliverMerged(list []*SavedSearch, subscriber string,
+	limit int) ([]*Order, map[string][]string) {
+	queues := make([][]*FeedItem, len(list))
+	passed := make([]map[string]bool, len(list))
+	for i, ss := range list {
+		items, err := s.archive.Pending(ss.URL, subscriber, limit)
+		if err != nil {
+			log.Println("Can't deliver orders:", err)
+			continue
+		}
+		queues[i] = items
+		orders := ItemsToOrders(items)
 		if len(orders) > 0 && s.config.IsFilterEnabled() {
-			var filtered float32
-			orders, filtered = s.filter.Execute(orders)
-			log.Printf("%.1f%% of orders were removed by filter\n",
-				filtered*100)
+			orders, _ = s.profiles.Get(ss.Filter).Execute(orders)
+		}
+		passed[i] = make(map[string]bool)
+		for _, order := range orders {
+			passed[i][order.Key()] = true
 		}
 	}
 
-	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
+	// items are taken from the oldest of all searches, so each search
+	// delivers its oldest items and its cursor isn't moved past the
+	// items which aren't taken
+	merger := NewMerger()
+	cursors := make([]uint64, len(list))
+	emitted := make([]int, len(list))
+	checked := make([]int, len(list))
+	for {
+		next := -1
+		for i, queue := range queues {
+			if len(queue) > 0 && (next < 0 || queue[0].PubDate.Before(
+				queues[next][0].PubDate)) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		item := queues[next][0]
+		key := item.Key()
+		if passed[next][key] && !merger.Has(key) && merger.Len() >= limit {
+			break
+		}
+		queues[next] = queues[next][1:]
+		cursors[next] = item.Seq
+		checked[next]++
+		if passed[next][key] {
+			emitted[next]++
+			merger.Add(list[next].Name, []*Order{item.ToOrder()})
+		}
+	}
 
-	render := NewRender(s.config)
+	for i, ss := range list {
+		if cursors[i] == 0 {
+			continue
+		}
+		if err := s.archive.SetCursor(ss.URL, subscriber,
+			cursors[i]); err != nil {
+			log.Println("Can't deliver orders:", err)
+		}
+		if s.config.IsFilterEnabled() {
+			s.metrics.OrdersServed(ss.URL, emitted[i], checked[i],
+				checked[i]-emitted[i])
+		} else {
+			s.metrics.OrdersServed(ss.URL, emitted[i], 0, 0)
+		}
+	}
+	return merger.Orders(limit)
+}
 
-	if URL, err := url.Parse(r.FormValue("url")); err == nil {
-		// call feed like search request
-		render.SetTitle(URL.Query().Get("searchString"))
+// feedOrders returns orders of feed with url rawurl which must be
+// served to subscriber. Subscriber receives orders which were not
+// served to it yet, client without subscriber receives the newest
+// orders of feed window. Orders are filtered by filter. Loading of
+// feed is cancelled when ctx of request is done
+func (s *Server) feedOrders(ctx context.Context, rawurl, subscriber string,
+	filter OrderFilter) (orders []*Order) {
+	var err error
+	// saved searches are polled by scheduler, so they are served from
+	// history without waiting for upstream
+	if !s.searches.Contains(rawurl) {
+		if err = s.fetch(ctx, rawurl); err != nil {
+			log.Println("Loading error:", err)
+		}
+	}
+
+	var items []*FeedItem
+	if len(subscriber) > 0 {
+		// each subscriber receives all orders which it has not received
+		// yet, even if another subscriber has fetched them
+		items, err = s.archive.Deliver(rawurl, subscriber)
 	} else {
-		log.Println("Getting feed title error:", err)
+		// feed contains recent orders, rss client removes duplicates
+		// by guid
+		windowItems, windowDays := s.config.GetFeedWindow()
+		if windowItems <= 0 && windowDays <= 0 {
+			windowItems = _FEED_DELIVERY_LIMIT
+		}
+		items, err = s.archive.Window(rawurl, windowItems, windowDays)
+	}
+	if err != nil {
+		log.Println("Can't deliver orders:", err)
+	} else {
+		orders = ItemsToOrders(items)
 	}
 
+	var checked, removed int
+	if len(orders) > 0 && s.config.IsFilterEnabled() {
+		var filtered float32
+		checked = len(orders)
+		orders, filtered = filter.Execute(orders)
+		removed = checked - len(orders)
+		LogInfof("%.1f%% of orders were removed by filter\n",
+			filtered*100)
+	}
+	s.metrics.OrdersServed(rawurl, len(orders), checked, removed)
+
+	return
+}
+
+// writeFeed writes rss feed with passed orders. If searches is not nil
+// each order is noted with names of saved searches by order key. Links
+// of items contain access token if it isn't empty
+func (s *Server) writeFeed(w http.ResponseWriter, token, title string,
+	orders []*Order, searches map[string][]string) {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	render := NewRender(s.config)
+	render.SetTitle(title)
+	render.SetAccessToken(token)
+
 	if len(orders) > 0 {
-		render.Compose(orders)
+		render.ComposeWithSearches(orders, searches)
 	}
 
 	if err := render.WriteTo(w); err != nil {
 		log.Println("Can't send response:", err)
 	}
+}
+
+// fetch fetches feed with url rawurl. Concurrent fetches of the same
+// feed share one fetching
+func (s *Server) fetch(ctx context.Context, rawurl string) error {
+	_, err := s.fetches.Do(ctx, rawurl,
+		func(ctx context.Context) ([]*Order, error) {
+			return s.Fetch(ctx, rawurl)
+		})
+	return err
+}
+
+// Fetch loads feed with url rawurl, reads new orders and saves them in
+// archive and in feed history. Loading is cancelled when ctx is done
+func (s *Server) Fetch(ctx context.Context, rawurl string) ([]*Order,
+	error) {
+	started := time.Now()
+	resp, err := Load(ctx, rawurl)
+	if err != nil {
+		s.metrics.UpstreamRequest(_METRICS_STATUS_ERROR, time.Since(started))
+		return nil, err
+	}
+	s.metrics.UpstreamRequest(strconv.Itoa(resp.StatusCode),
+		time.Since(started))
+	defer resp.Body.Close()
 
-	// signal that request was processed
-	s.Done()
+	if resp.StatusCode != 200 {
+		return nil, errors.New("Server return status " + resp.Status)
+	}
+
+	orders, err := s.reader.ReadOrders(rawurl, resp)
+	if err != nil && err != io.EOF {
+		// reading was cut short, cache isn't updated and orders are
+		// read again next time
+		log.Println("Can't read or parse response: ", err)
+		return nil, err
+	}
+	if items, err := s.archive.StoreFeed(rawurl, orders); err != nil {
+		log.Println("Can't archive orders:", err)
+	} else {
+		// starred orders are checked before filtering
+		s.stars.Check(items)
+		s.notify(rawurl, items)
+	}
+
+	LogDebugf("Loaded %d orders\n", len(orders))
+	return orders, nil
+}
+
+// FetchOrder loads orders found by order id. Orders aren't saved in
+// archive and feed history
+func (s *Server) FetchOrder(ctx context.Context, id string) ([]*Order,
+	error) {
+	query := &SearchQuery{Keywords: id}
+	started := time.Now()
+	resp, err := Load(ctx, query.URL())
+	if err != nil {
+		s.metrics.UpstreamRequest(_METRICS_STATUS_ERROR, time.Since(started))
+		return nil, err
+	}
+	s.metrics.UpstreamRequest(strconv.Itoa(resp.StatusCode),
+		time.Since(started))
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, errors.New("Server return status " + resp.Status)
+	}
+	return ParseOrders(resp.Body)
+}
+
+// feedFilter returns filter of feed with url rawurl: filter of saved
+// search profile or default filter
+func (s *Server) feedFilter(rawurl string) OrderFilter {
+	if ss, err := s.searches.GetByURL(rawurl); err == nil {
+		return s.profiles.Get(ss.Filter)
+	}
+	return s.profiles.Get("")
+}
+
+// filterItems filters items of feed with url rawurl by feed filter if
+// filter is enabled
+func (s *Server) filterItems(rawurl string, items []*FeedItem) []*FeedItem {
+	if s.config.IsFilterEnabled() {
+		return FilterItems(items, s.feedFilter(rawurl))
+	}
+	return items
+}
+
+// notify passes new filtered orders of feed to notifiers
+func (s *Server) notify(rawurl string, items []*FeedItem) {
+	total := len(items)
+	items = s.filterItems(rawurl, items)
+	if s.config.IsFilterEnabled() {
+		s.diag.OrdersFiltered(rawurl, total, total-len(items))
+	}
+	if len(items) == 0 {
+		return
+	}
+	event := &FeedEvent{URL: rawurl, Items: items}
+	if ss, err := s.searches.GetByURL(rawurl); err == nil {
+		event.Search = ss
+	}
+	for _, notifier := range s.notifiers {
+		notifier.Notify(event)
+	}
 }
 
+// alert passes alert of starred order to alerters
+func (s *Server) alert(alert *StarAlert) {
+	LogInfo("Star alert:", alert.Message)
+	for _, alerter := range s.alerters {
+		alerter.Alert(alert)
+	}
+}
+
+// ShortLinkHandler redirects to order page. If parameter star contains
+// order key starring of order is confirmed with form which posts to the
+// same link, order is starred on POST
 func (s *Server) ShortLinkHandler(w http.ResponseWriter,
 	r *http.Request) {
+	defer r.Body.Close()
+
 	// redirect if order id was not passed also
-	http.Redirect(w, r, MakeLink(r.FormValue("order")),
-		http.StatusFound)
-	r.Body.Close()
+	link := MakeLink(r.FormValue("order"))
+	key := r.FormValue("star")
+	if len(key) == 0 {
+		http.Redirect(w, r, link, http.StatusFound)
+		return
+	}
+
+	if r.Method == "POST" {
+		if !s.validRequest(r) {
+			http.Error(w, "Invalid form token", http.StatusForbidden)
+			return
+		}
+		if _, err := s.archive.StarOrder(key); err != nil {
+			log.Println("Can't star order:", err)
+		}
+		http.Redirect(w, r, link, http.StatusSeeOther)
+		return
+	}
+
+	title := key
+	if record, err := s.archive.Get(key); err != nil {
+		log.Println("Can't read order:", err)
+	} else if record != nil {
+		title = MakeTitle(&record.Order)
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := WriteStarPage(w, title, link, s.csrfToken); err != nil {
+		log.Println("Can't send star page:", err)
+	}
+}
+
+func (s *Server) DiagnosticsHandler(w http.ResponseWriter,
+	r *http.Request) {
+	defer r.Body.Close()
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+
+	if err := s.diag.Render(w); err != nil {
+		log.Println("Can't send diagnostics:", err)
+	}
+}
+
+// SearchHandler searches orders in archive. Handler returns json if
+// passed parameter format=json and html page with search form
+// otherwise
+func (s *Server) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	asJSON := r.Form.Get("format") == "json"
+	r.Form.Del("format")
+
+	var records []*ArchiveRecord
+	q, err := ParseArchiveQuery(r.Form)
+	if err == nil && len(r.Form) > 0 {
+		if records, err = s.archive.Search(q); err != nil {
+			log.Println("Archive search error:", err)
+		}
+	}
+
+	if asJSON {
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		err = WriteSearchJSON(w, records)
+	} else {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		err = WriteSearchPage(w, r.Form, records, err)
+	}
+	if err != nil {
+		log.Println("Can't send search result:", err)
+	}
+}
+
+// SearchesPageHandler shows saved searches and handles form actions:
+// save and delete
+func (s *Server) SearchesPageHandler(w http.ResponseWriter,
+	r *http.Request) {
+	defer r.Body.Close()
+
+	var pageErr error
+	if r.Method == "POST" {
+		if !s.validRequest(r) {
+			http.Error(w, "Invalid form token", http.StatusForbidden)
+			return
+		}
+		switch r.FormValue("action") {
+		case "save":
+			ss, err := ParseSavedSearchForm(r.PostForm)
+			if err != nil {
+				pageErr = err
+			} else if _, err = s.searches.Get(ss.Slug); err == nil {
+				pageErr = s.searches.Update(ss.Slug, ss)
+			} else {
+				pageErr = s.searches.Add(ss)
+			}
+		case "delete":
+			pageErr = s.searches.Remove(r.PostFormValue("slug"))
+		default:
+			pageErr = errors.New("Unknown action")
+		}
+		if pageErr == nil {
+			// prevent form resubmission
+			http.Redirect(w, r, s.config.GetBaseURL()+_PATH_TO_SEARCHES,
+				http.StatusSeeOther)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if pageErr != nil {
+		w.WriteHeader(http.StatusBadRequest)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	if err := WriteSearchesPage(w, s.config.GetBaseURL(),
+		s.searches.List(), s.csrfToken, pageErr); err != nil {
+		log.Println("Can't send saved searches:", err)
+	}
+}
+
+// SearchesAPIHandler manages saved searches with json api:
+// GET and POST /api/searches, GET, PUT and DELETE /api/searches/<slug>
+func (s *Server) SearchesAPIHandler(w http.ResponseWriter,
+	r *http.Request) {
+	defer r.Body.Close()
+
+	slug := strings.Trim(strings.TrimPrefix(r.URL.Path,
+		_PATH_TO_SEARCH_API), "/")
+	if r.Method == "POST" && !s.validRequest(r) {
+		http.Error(w, "Invalid request content type", http.StatusForbidden)
+		return
+	}
+
+	var (
+		result interface{}
+		status = http.StatusOK
+		err    error
+	)
+
+	switch {
+	case len(slug) == 0 && r.Method == "GET":
+		result = s.searches.List()
+	case len(slug) == 0 && r.Method == "POST":
+		ss := new(SavedSearch)
+		if err = json.NewDecoder(r.Body).Decode(ss); err == nil {
+			err = s.searches.Add(ss)
+		} else {
+			err = &ErrInvalidSearch{err}
+		}
+		result, status = ss, http.StatusCreated
+	case len(slug) > 0 && r.Method == "GET":
+		result, err = s.searches.Get(slug)
+	case len(slug) > 0 && r.Method == "PUT":
+		ss := new(SavedSearch)
+		if err = json.NewDecoder(r.Body).Decode(ss); err == nil {
+			err = s.searches.Update(slug, ss)
+		} else {
+			err = &ErrInvalidSearch{err}
+		}
+		result = ss
+	case len(slug) > 0 && r.Method == "DELETE":
+		err = s.searches.Remove(slug)
+		status = http.StatusNoContent
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		switch err.(type) {
+		case *ErrInvalidSearch:
+			status = http.StatusBadRequest
+		default:
+			switch err {
+			case ErrSearchNotFound:
+				status = http.StatusNotFound
+			case ErrSearchExists:
+				status = http.StatusConflict
+			default:
+				log.Println("Saved searches error:", err)
+				status = http.StatusInternalServerError
+			}
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if status == http.StatusNoContent {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		log.Println("Can't send saved searches:", err)
+	}
+}
+
+// OPMLHandler exports feeds of all saved searches as opml
+func (s *Server) OPMLHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+	w.Header().Set("Content-Disposition",
+		`attachment; filename="ru-supplier.opml"`)
+	w.WriteHeader(http.StatusOK)
+
+	opml := MakeOPML(s.searches.List(), s.config.GetBaseURL(),
+		s.accessToken(r))
+	if err := opml.Render(w); err != nil {
+		log.Println("Can't send opml:", err)
+	}
+}
+
+// OPMLImportHandler creates saved searches by opml document with
+// /rss?url= feed links. Document is passed in request body or in form
+// file field "file"
+func (s *Server) OPMLImportHandler(w http.ResponseWriter,
+	r *http.Request) {
+	defer r.Body.Close()
+
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !s.validRequest(r) {
+		http.Error(w, "Invalid form token", http.StatusForbidden)
+		return
+	}
+
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"),
+		"multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	opml, err := ReadOPML(body)
+	if err != nil {
+		http.Error(w, "Invalid opml: "+err.Error(),
+			http.StatusBadRequest)
+		return
+	}
+
+	result := ImportOPML(s.searches, opml)
+	LogInfof("Imported %d saved searches from opml\n",
+		len(result.Imported))
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		log.Println("Can't send import result:", err)
+	}
+}
+
+// EventsHandler streams new filtered orders as server-sent events.
+// Parameter feed contains saved search slug, parameter url contains
+// feed url, without them orders of all feeds are streamed. Orders
+// after Last-Event-ID are sent again when client reconnects
+func (s *Server) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	s.Add(1) // signal that yet another request is processed
+
+	defer s.Done()
+	defer r.Body.Close()
+
+	if s.unavailable(w) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported",
+			http.StatusInternalServerError)
+		return
+	}
+
+	var feedID string
+	if slug := r.FormValue("feed"); len(slug) > 0 {
+		ss, err := s.searches.Get(slug)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		feedID = FeedID(ss.URL)
+	} else if rawurl := r.FormValue("url"); len(rawurl) > 0 {
+		feedURL, err := FeedURL(rawurl)
+		if err != nil {
+			http.Error(w, "Invalid feed url: "+err.Error(),
+				http.StatusBadRequest)
+			return
+		}
+		feedID = FeedID(feedURL)
+	}
+
+	var lastID uint64
+	// EventSource sends header, polyfills may send parameter
+	str := r.Header.Get("Last-Event-ID")
+	if len(str) == 0 {
+		str = r.FormValue("lastEventId")
+	}
+	if len(str) > 0 {
+		var err error
+		if lastID, err = strconv.ParseUint(str, 10, 64); err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// subscribe before replay, so orders are not lost between them
+	sub := s.events.Subscribe(feedID)
+	defer s.events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	if lastID > 0 {
+		for _, event := range s.replayEvents(feedID, lastID) {
+			if err := event.Render(w); err != nil {
+				log.Println("Can't send event:", err)
+				return
+			}
+			lastID = event.Seq
+		}
+	}
+	flusher.Flush()
+
+	ticker := time.NewTicker(_EVENTS_KEEP_ALIVE)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			// event could be sent by replay, alerts have no id
+			if event.Alert == nil && event.Seq <= lastID {
+				continue
+			}
+			if err := event.Render(w); err != nil {
+				log.Println("Can't send event:", err)
+				return
+			}
+			if event.Alert == nil {
+				lastID = event.Seq
+			}
+		case <-ticker.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// replayEvents returns filtered orders of feed with id feedID or of
+// all feeds which were appended after event with id lastID
+func (s *Server) replayEvents(feedID string, lastID uint64) []*OrderEvent {
+	feedIDs := []string{feedID}
+	if len(feedID) == 0 {
+		var err error
+		if feedIDs, err = s.archive.FeedIDs(); err != nil {
+			log.Println("Can't read feeds:", err)
+			return nil
+		}
+	}
+
+	searches := make(map[string]*SavedSearch)
+	for _, ss := range s.searches.List() {
+		searches[FeedID(ss.URL)] = ss
+	}
+
+	var events []*OrderEvent
+	for _, id := range feedIDs {
+		items, err := s.archive.ItemsSince(id, lastID,
+			_EVENTS_REPLAY_LIMIT)
+		if err != nil {
+			log.Println("Can't read feed history:", err)
+			continue
+		}
+		var slug string
+		filter := s.profiles.Get("")
+		if ss, ok := searches[id]; ok {
+			slug = ss.Slug
+			filter = s.profiles.Get(ss.Filter)
+		}
+		if s.config.IsFilterEnabled() {
+			items = FilterItems(items, filter)
+		}
+		for _, item := range items {
+			events = append(events,
+				&OrderEvent{item.Seq, id, slug, item.ArchiveRecord, nil})
+		}
+	}
+
+	SortEvents(events)
+	if len(events) > _EVENTS_REPLAY_LIMIT {
+		events = events[:_EVENTS_REPLAY_LIMIT]
+	}
+	return events
+}
+
+// DeadLettersHandler returns webhook requests which were not delivered
+// in json on GET and puts them into delivery queues again on POST
+func (s *Server) DeadLettersHandler(w http.ResponseWriter,
+	r *http.Request) {
+	defer r.Body.Close()
+
+	var result interface{}
+	switch r.Method {
+	case "GET":
+		result = s.webhooks.dead.List()
+	case "POST":
+		if !s.validRequest(r) {
+			http.Error(w, "Invalid request content type",
+				http.StatusForbidden)
+			return
+		}
+		count, err := s.webhooks.Redeliver()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		result = map[string]int{"Redelivered": count}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Println("Can't send response:", err)
+	}
+}
+
+// StarsAPIHandler returns starred orders on GET, stars order with key
+// from parameter key on POST and unstars it on DELETE
+func (s *Server) StarsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var (
+		result interface{}
+		err    error
+		status = http.StatusOK
+	)
+	if (r.Method == "POST" || r.Method == "DELETE") && !s.validRequest(r) {
+		http.Error(w, "Invalid request content type", http.StatusForbidden)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		var stars []*Star
+		if stars, err = s.archive.Stars(); err == nil {
+			if stars == nil {
+				stars = []*Star{}
+			}
+			result = stars
+		}
+	case "POST":
+		if result, err = s.archive.StarOrder(r.FormValue("key")); err == nil {
+			status = http.StatusCreated
+		}
+	case "DELETE":
+		if err = s.archive.UnstarOrder(r.FormValue("key")); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err == ErrOrderNotFound {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Println("Stars error:", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err = json.NewEncoder(w).Encode(result); err != nil {
+		log.Println("Can't send response:", err)
+	}
+}
+
+// DashboardHandler shows server state and performs actions of tray menu
+func (s *Server) DashboardHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	if r.URL.Path != _PATH_TO_DASHBOARD {
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method == "POST" {
+		// actions are accepted only from dashboard page, so other
+		// sites can't post them from browser of user
+		if !s.validRequest(r) {
+			http.Error(w, "Invalid form token", http.StatusForbidden)
+			return
+		}
+		action := r.FormValue("action")
+		var err error
+		switch action {
+		case _DASHBOARD_ACTION_RESUME:
+			err = s.Resume()
+		case _DASHBOARD_ACTION_PAUSE:
+			err = s.Pause()
+		case _DASHBOARD_ACTION_FILTER_ENABLE:
+			s.config.SetFilterEnabled(true)
+		case _DASHBOARD_ACTION_FILTER_DISABLE:
+			s.config.SetFilterEnabled(false)
+		case _DASHBOARD_ACTION_REMOVE_CACHE:
+			err = s.RemoveCache()
+		case _DASHBOARD_ACTION_EXIT:
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, _DASHBOARD_NOTICE_EXIT)
+			// response must be sent before server is shut down
+			go s.Exit()
+			return
+		default:
+			http.Error(w, "Unknown action", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Println("Dashboard action error:", err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		// redirect after post, so page reloading doesn't repeat action
+		http.Redirect(w, r,
+			s.config.GetBaseURL()+_PATH_TO_DASHBOARD+"?done="+action,
+			http.StatusSeeOther)
+		return
+	}
+
+	dashboard := &Dashboard{
+		Paused:        s.IsPaused(),
+		FilterEnabled: s.config.IsFilterEnabled(),
+		BaseURL:       s.config.GetBaseURL(),
+		Listen:        s.config.GetHost() + ":" + s.config.GetPort(),
+		Started:       s.started,
+		DeadLetters:   len(s.webhooks.dead.List()),
+		CSRFToken:     s.csrfToken,
+		Message:       dashboardNotices[r.FormValue("done")],
+	}
+	var err error
+	if dashboard.Orders, err = s.archive.Count(); err != nil {
+		log.Println("Can't count archived orders:", err)
+	}
+	if stars, err := s.archive.Stars(); err != nil {
+		log.Println("Can't read stars:", err)
+	} else {
+		dashboard.Stars = len(stars)
+	}
+	if dashboard.Dir, err = filepath.Abs(s.config.GetDataDir()); err != nil {
+		log.Println("Can't get data directory:", err)
+	}
+
+	states := s.scheduler.States()
+	token := s.accessToken(r)
+	for _, ss := range s.searches.List() {
+		feed := &DashboardFeed{
+			SavedSearch: ss,
+			FeedLink: AddAccessToken(
+				MakeFeedLink(ss.Slug, s.config.GetBaseURL()), token),
+			State: states[ss.URL],
+		}
+		if feed.Orders, err = s.archive.FeedSize(ss.URL); err != nil {
+			log.Println("Can't count feed orders:", err)
+		}
+		if fd := s.diag.Feed(ss.URL); fd != nil {
+			feed.Errors = fd.Errors()
+			feed.RemovedPercent = fd.RemovedPercent()
+		}
+		dashboard.Feeds = append(dashboard.Feeds, feed)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err = dashboard.Render(w); err != nil {
+		log.Println("Can't send dashboard:", err)
+	}
+}
+
+// GenerateHandler shows form which converts url of search page into
+// link to feed
+func (s *Server) GenerateHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var (
+		search = r.FormValue("search")
+		link   *GeneratedLink
+		err    error
+	)
+	if len(search) > 0 {
+		link, err = GenerateLink(search, s.config.GetBaseURL())
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err = WriteGeneratePage(w, s.config.GetBaseURL(), search, link,
+		s.csrfToken, err); err != nil {
+		log.Println("Can't send link generator:", err)
+	}
+}
+
+// GenerateAPIHandler converts url of search page into link to feed
+// with json api: GET /api/generate?search=<url of search page>
+func (s *Server) GenerateAPIHandler(w http.ResponseWriter,
+	r *http.Request) {
+	defer r.Body.Close()
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	link, err := GenerateLink(r.FormValue("search"),
+		s.config.GetBaseURL())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(link); err != nil {
+		log.Println("Can't send generated link:", err)
+	}
+}
+
+// decode decodes feed link, links of saved searches /feed/<slug> are
+// decoded too
+func (s *Server) decode(rawurl string) (*DecodedSearch, error) {
+	if URL, err := url.Parse(strings.TrimSpace(rawurl)); err == nil {
+		// link may contain path prefix of proxy
+		if i := strings.Index(URL.Path, _PATH_TO_FEEDS+"/"); i > -1 {
+			ss, err := s.searches.Get(
+				URL.Path[i+len(_PATH_TO_FEEDS)+1:])
+			if err != nil {
+				return nil, err
+			}
+			rawurl = ss.URL
+		}
+	}
+	return DecodeSearchURL(rawurl)
+}
+
+// DecodeHandler shows form which explains what feed link searches for
+func (s *Server) DecodeHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	var (
+		rawurl  = r.FormValue("url")
+		decoded *DecodedSearch
+		err     error
+	)
+	if len(rawurl) > 0 {
+		decoded, err = s.decode(rawurl)
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err = WriteDecodePage(w, rawurl, decoded, err); err != nil {
+		log.Println("Can't send link decoder:", err)
+	}
+}
+
+// DecodeAPIHandler explains what feed link searches for with json api:
+// GET /api/decode?url=<feed link>
+func (s *Server) DecodeAPIHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	decoded, err := s.decode(r.FormValue("url"))
+	if err != nil {
+		status := http.StatusBadRequest
+		if err == ErrSearchNotFound {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err = json.NewEncoder(w).Encode(decoded); err != nil {
+		log.Println("Can't send decoded link:", err)
+	}
+}
+
+// HealthHandler reports that proxy process serves requests
+func (s *Server) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "ok\n")
+}
+
+// ReadyHandler reports that proxy serves feeds: it isn't paused from
+// dashboard and shutdown didn't begin
+func (s *Server) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	if s.unavailable(w) {
+		return
+	}
+	if err := r.Context().Err(); err != nil {
+		http.Error(w, "Proxy is shutting down",
+			http.StatusServiceUnavailable)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, "ready\n")
+}
+
+// MetricsHandler writes metrics in Prometheus text format
+func (s *Server) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if err := s.metrics.Render(w, &MetricsSnapshot{
+		Paused:      s.IsPaused(),
+		CacheSize:   s.reader.CacheSize(),
+		Diagnostics: s.diag.Feeds(),
+		Polls:       s.scheduler.States(),
+		Label:       s.feedLabel,
+	}); err != nil {
+		log.Println("Can't send metrics:", err)
+	}
+}
+
+// feedLabel returns slug of saved search with url rawurl or rawurl.
+// Feed urls are normalized and count of feeds in metrics and
+// diagnostics is limited, so count of labels is limited too
+func (s *Server) feedLabel(rawurl string) string {
+	if ss, err := s.searches.GetByURL(rawurl); err == nil {
+		return ss.Slug
+	}
+	return rawurl
 }
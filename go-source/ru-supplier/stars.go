@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// period of checking which reminders must be sent
+const _STARS_TICK = time.Minute
+
+// period of loading of starred orders, so changes of orders are found
+// even if orders aren't new in any feed
+const _STARS_REFRESH_INTERVAL = time.Hour
+
+// Kinds of star alerts
+const (
+	_ALERT_REMINDER = "reminder"
+	_ALERT_STAGE    = "stage"
+	_ALERT_DEADLINE = "deadline"
+)
+
+var ErrOrderNotFound = errors.New("Order not found in archive")
+
+// Star is order which is tracked until its filing deadline. Order
+// contains the latest known version of order, Reminded contains offsets
+// in hours before deadline of sent reminders
+type Star struct {
+	Order    *ArchiveRecord
+	Starred  time.Time
+	Reminded []int
+}
+
+func (star *Star) reminded(hours int) bool {
+	for _, h := range star.Reminded {
+		if h == hours {
+			return true
+		}
+	}
+	return false
+}
+
+// StarAlert is filing deadline reminder or alert about changed stage or
+// deadline of starred order
+type StarAlert struct {
+	Kind    string
+	Message string
+	Order   *ArchiveRecord
+}
+
+// StarFetcher loads orders found by order id. Loading is cancelled when
+// ctx is done
+type StarFetcher func(ctx context.Context, id string) ([]*Order, error)
+
+// Alerter is notified about starred orders. Alert must not block for
+// a long time
+type Alerter interface {
+	Alert(alert *StarAlert)
+}
+
+// StarOrder starts tracking of archived order with passed key
+func (a *Archive) StarOrder(key string) (star *Star, err error) {
+	err = a.db.Update(func(tx *bolt.Tx) error {
+		bStars := tx.Bucket(_ARCHIVE_BUCKET_STARS)
+		if data := bStars.Get([]byte(key)); data != nil {
+			star = new(Star)
+			return json.Unmarshal(data, star)
+		}
+		data := tx.Bucket(_ARCHIVE_BUCKET_ORDERS).Get([]byte(key))
+		if data == nil {
+			return ErrOrderNotFound
+		}
+		star = &Star{Order: new(ArchiveRecord), Starred: time.Now()}
+		if err := json.Unmarshal(data, star.Order); err != nil {
+			return err
+		}
+		return putStar(tx, star)
+	})
+	if err != nil {
+		star = nil
+	}
+	return
+}
+
+// UnstarOrder stops tracking of order with passed key
+func (a *Archive) UnstarOrder(key string) error {
+	return a.db.Update(func(tx *bolt.Tx) error {
+		bStars := tx.Bucket(_ARCHIVE_BUCKET_STARS)
+		if bStars.Get([]byte(key)) == nil {
+			return ErrOrderNotFound
+		}
+		return bStars.Delete([]byte(key))
+	})
+}
+
+// Stars returns starred orders sorted by filing deadline
+func (a *Archive) Stars() (stars []*Star, err error) {
+	err = a.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(_ARCHIVE_BUCKET_STARS).ForEach(
+			func(_, data []byte) error {
+				star := new(Star)
+				if err := json.Unmarshal(data, star); err != nil {
+					return err
+				}
+				stars = append(stars, star)
+				return nil
+			})
+	})
+	sort.Sort(starsByDeadline(stars))
+	return
+}
+
+// UpdateStar saves star if order is still starred
+func (a *Archive) UpdateStar(star *Star) error {
+	return a.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(_ARCHIVE_BUCKET_STARS).Get(
+			[]byte(star.Order.Key())) == nil {
+			return nil
+		}
+		return putStar(tx, star)
+	})
+}
+
+func putStar(tx *bolt.Tx, star *Star) error {
+	data, err := json.Marshal(star)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(_ARCHIVE_BUCKET_STARS).Put([]byte(star.Order.Key()),
+		data)
+}
+
+type starsByDeadline []*Star
+
+func (s starsByDeadline) Len() int      { return len(s) }
+func (s starsByDeadline) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s starsByDeadline) Less(i, j int) bool {
+	return s[i].Order.FinishFilingDate.Before(s[j].Order.FinishFilingDate)
+}
+
+// Stars sends reminders before filing deadlines of starred orders and
+// alerts about changes of starred orders
+type Stars struct {
+	archive *Archive
+	offsets []int // hours before deadline
+	fetch   StarFetcher
+	alert   func(*StarAlert)
+	update  sync.Mutex // serializes updates of stars
+
+	mutex sync.Mutex
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewStars creates tracker which sends reminders offsets hours before
+// deadlines. Starred orders are loaded by fetch periodically. Alerts
+// are passed to alert
+func NewStars(archive *Archive, offsets []int, fetch StarFetcher,
+	alert func(*StarAlert)) *Stars {
+	if archive == nil {
+		panic("NewStars(): passed nil archive")
+	}
+	if fetch == nil {
+		panic("NewStars(): passed nil fetch function")
+	}
+	if alert == nil {
+		panic("NewStars(): passed nil alert function")
+	}
+	return &Stars{archive: archive, offsets: offsets, fetch: fetch,
+		alert: alert}
+}
+
+// Start starts sending of reminders in background
+func (s *Stars) Start() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.stop != nil {
+		return errors.New("Stars are already running")
+	}
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go s.run(s.stop)
+	return nil
+}
+
+// Stop stops sending of reminders
+func (s *Stars) Stop() error {
+	s.mutex.Lock()
+	if s.stop == nil {
+		s.mutex.Unlock()
+		return errors.New("Stars are already stopped")
+	}
+	close(s.stop)
+	s.stop = nil
+	s.mutex.Unlock()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Stars) run(stop chan struct{}) {
+	defer s.wg.Done()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	ticker := time.NewTicker(_STARS_TICK)
+	defer ticker.Stop()
+	refresh := time.NewTicker(_STARS_REFRESH_INTERVAL)
+	defer refresh.Stop()
+	for {
+		s.remind(time.Now())
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-refresh.C:
+			s.refresh(ctx)
+		}
+	}
+}
+
+// refresh loads starred orders by order ids and checks their changes
+func (s *Stars) refresh(ctx context.Context) {
+	stars, err := s.archive.Stars()
+	if err != nil {
+		log.Println("Can't read stars:", err)
+		return
+	}
+	var records []*ArchiveRecord
+	for _, star := range stars {
+		orders, err := s.fetch(ctx, star.Order.OrderId)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Println("Can't load starred order:", err)
+			continue
+		}
+		for _, order := range orders {
+			if order.Key() == star.Order.Key() {
+				record := NewArchiveRecord(order)
+				record.Archived = star.Order.Archived
+				record.Updated = time.Now()
+				records = append(records, record)
+				break
+			}
+		}
+	}
+	s.check(records)
+}
+
+// remind sends reminders which time has come. Only the nearest missed
+// reminder is sent, for example after server downtime
+func (s *Stars) remind(now time.Time) {
+	s.update.Lock()
+	defer s.update.Unlock()
+	stars, err := s.archive.Stars()
+	if err != nil {
+		log.Println("Can't read stars:", err)
+		return
+	}
+	for _, star := range stars {
+		deadline := star.Order.FinishFilingDate
+		if deadline.IsZero() || !now.Before(deadline) {
+			continue
+		}
+		due := -1
+		for _, hours := range s.offsets {
+			if star.reminded(hours) {
+				continue
+			}
+			if !now.Before(deadline.Add(-time.Duration(hours) * time.Hour)) {
+				star.Reminded = append(star.Reminded, hours)
+				if due == -1 || hours < due {
+					due = hours
+				}
+			}
+		}
+		if due == -1 {
+			continue
+		}
+		if err = s.archive.UpdateStar(star); err != nil {
+			log.Println("Can't save star:", err)
+			continue
+		}
+		left := int(deadline.Sub(now).Hours())
+		s.alert(&StarAlert{
+			_ALERT_REMINDER,
+			MakeTitle(&star.Order.Order) + ": до окончания подачи " +
+				"заявок осталось " + strconv.Itoa(left) + " ч (" +
+				RusFormatDate(deadline) + ")",
+			star.Order,
+		})
+	}
+}
+
+// Check compares new versions of orders with starred orders and sends
+// alerts if stage or filing deadline was changed
+func (s *Stars) Check(items []*FeedItem) {
+	records := make([]*ArchiveRecord, len(items))
+	for i, item := range items {
+		records[i] = item.ArchiveRecord
+	}
+	s.check(records)
+}
+
+func (s *Stars) check(records []*ArchiveRecord) {
+	if len(records) == 0 {
+		return
+	}
+	s.update.Lock()
+	defer s.update.Unlock()
+	stars, err := s.archive.Stars()
+	if err != nil || len(stars) == 0 {
+		if err != nil {
+			log.Println("Can't read stars:", err)
+		}
+		return
+	}
+	starred := make(map[string]*Star, len(stars))
+	for _, star := range stars {
+		starred[star.Order.Key()] = star
+	}
+
+	for _, record := range records {
+		star, ok := starred[record.Key()]
+		if !ok {
+			continue
+		}
+		old := star.Order
+		var alerts []*StarAlert
+		if record.OrderStage != old.OrderStage {
+			alerts = append(alerts, &StarAlert{
+				_ALERT_STAGE,
+				MakeTitle(&record.Order) + ": этап закупки изменен с «" +
+					old.OrderStage + "» на «" + record.OrderStage + "»",
+				record,
+			})
+		}
+		if !record.FinishFilingDate.Equal(old.FinishFilingDate) {
+			alerts = append(alerts, &StarAlert{
+				_ALERT_DEADLINE,
+				MakeTitle(&record.Order) + ": срок подачи заявок изменен с " +
+					RusFormatDate(old.FinishFilingDate) + " на " +
+					RusFormatDate(record.FinishFilingDate),
+				record,
+			})
+			// reminders are sent again for new deadline
+			star.Reminded = nil
+		}
+		star.Order = record
+		if err = s.archive.UpdateStar(star); err != nil {
+			log.Println("Can't save star:", err)
+		}
+		for _, alert := range alerts {
+			s.alert(alert)
+		}
+	}
+}
+
+// MailAlerter sends star alerts by email
+type MailAlerter struct {
+	mailer *Mailer
+	to     []string
+}
+
+func NewMailAlerter(mailer *Mailer, to []string) *MailAlerter {
+	if mailer == nil {
+		panic("NewMailAlerter(): passed nil mailer")
+	}
+	return &MailAlerter{mailer, to}
+}
+
+// Alert sends alert in background
+func (m *MailAlerter) Alert(alert *StarAlert) {
+	go func() {
+		err := m.mailer.Send(m.to, alert.Message,
+			MakeDescription(alert.Order.ToOrder()))
+		if err != nil {
+			log.Println("Can't send alert:", err)
+		}
+	}()
+}
+
+var starTmpl = template.Must(template.New("star").Parse(`<!DOCTYPE html>
+<html>
+	<head>
+		<meta charset="utf-8" />
+		<title>Отметить закупку</title>
+		<style>
+			body {font-family: sans-serif; font-size: 10pt;}
+			h1 {font-size: 15pt;}
+			form div {margin: 5px 0px;}
+			a {color: #000; word-break: break-all;}
+			a:hover {background-color: #444; color: #fff;}
+		</style>
+	</head>
+	<body>
+		<h1>Отметить закупку</h1>
+		<div>{{.Title}}</div>
+		<form method="post">
+			<input type="hidden" name="{{.CSRF.Param}}" value="{{.CSRF.Token}}" />
+			<div>
+				<input type="submit" value="Отметить и открыть" />
+				<a href="{{.Link}}">Открыть без отметки</a>
+			</div>
+		</form>
+	</body>
+</html>`))
+
+// WriteStarPage writes html page which confirms starring of order with
+// passed title. Link is order page, csrf is token of form
+func WriteStarPage(w io.Writer, title, link, csrf string) error {
+	return starTmpl.Execute(w, map[string]interface{}{
+		"Title": title,
+		"Link":  link,
+		"CSRF": map[string]string{
+			"Param": _DASHBOARD_CSRF_PARAM,
+			"Token": csrf,
+		},
+	})
+}
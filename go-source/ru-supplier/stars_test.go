@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testStarsFeed = "http://zakupki.gov.ru/epz/order/quicksearch/search.html?searchString=test"
+
+func TestStarsRefreshStage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	archive, err := OpenArchive(filepath.Join(dir, "archive.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer archive.Close()
+
+	order := &Order{OrderId: "0123", OrderStage: "Подача заявок"}
+	if _, err = archive.StoreFeed(testStarsFeed, []*Order{order}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = archive.StarOrder(order.Key()); err != nil {
+		t.Fatal(err)
+	}
+
+	// order is already in feed history, so it isn't new in feed
+	changed := *order
+	changed.OrderStage = "Работа комиссии"
+	items, err := archive.StoreFeed(testStarsFeed, []*Order{&changed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 0 {
+		t.Fatalf("%d new items of seen order", len(items))
+	}
+
+	var alerts []*StarAlert
+	var fetched []string
+	stars := NewStars(archive, nil,
+		func(ctx context.Context, id string) ([]*Order, error) {
+			fetched = append(fetched, id)
+			found := changed
+			return []*Order{&found}, nil
+		},
+		func(alert *StarAlert) {
+			alerts = append(alerts, alert)
+		})
+	stars.Check(items)
+	stars.refresh(context.Background())
+
+	if len(fetched) != 1 || fetched[0] != order.OrderId {
+		t.Errorf("fetched orders %q", fetched)
+	}
+	if len(alerts) != 1 || alerts[0].Kind != _ALERT_STAGE {
+		t.Fatalf("alerts %+v, expected stage alert", alerts)
+	}
+	list, err := archive.Stars()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Order.OrderStage != changed.OrderStage {
+		t.Errorf("starred order isn't updated: %+v", list)
+	}
+
+	// stage isn't changed since the last refresh
+	alerts = nil
+	stars.refresh(context.Background())
+	if len(alerts) != 0 {
+		t.Errorf("alerts %+v without changes", alerts)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Files of self-signed certificate which is generated in data directory
+const (
+	_TLS_CERT_FILE_NAME = "cert.pem"
+	_TLS_KEY_FILE_NAME  = "key.pem"
+)
+
+// Validity of self-signed certificate in years
+const _TLS_SELF_SIGNED_YEARS = 10
+
+// TLSConfig contains paths of certificate and private key in PEM
+// format. If both paths are empty self-signed certificate is generated
+// in data directory on first run. Relative paths are relative to data
+// directory
+type TLSConfig struct {
+	CertFile string `json:",omitempty"`
+	KeyFile  string `json:",omitempty"`
+}
+
+// Verify checks tls settings
+func (c *TLSConfig) Verify() error {
+	if (len(c.CertFile) == 0) != (len(c.KeyFile) == 0) {
+		return errors.New("TLS: both certificate and key files required")
+	}
+	return nil
+}
+
+// LoadCertificate loads certificate. Self-signed certificate for hosts
+// is generated if paths are empty and it doesn't exist in dataDir yet
+func (c *TLSConfig) LoadCertificate(dataDir string,
+	hosts []string) (cert tls.Certificate, err error) {
+	certFile, keyFile := c.CertFile, c.KeyFile
+	if len(certFile) == 0 {
+		certFile = filepath.Join(dataDir, _TLS_CERT_FILE_NAME)
+		keyFile = filepath.Join(dataDir, _TLS_KEY_FILE_NAME)
+		if _, err = os.Stat(certFile); os.IsNotExist(err) {
+			if err = generateCertificate(certFile, keyFile,
+				hosts); err != nil {
+				return
+			}
+			LogInfo("Self-signed certificate is generated:", certFile)
+		}
+	} else {
+		if !filepath.IsAbs(certFile) {
+			certFile = filepath.Join(dataDir, certFile)
+		}
+		if !filepath.IsAbs(keyFile) {
+			keyFile = filepath.Join(dataDir, keyFile)
+		}
+	}
+	return tls.LoadX509KeyPair(certFile, keyFile)
+}
+
+// generateCertificate writes self-signed certificate for hosts and its
+// private key into files certFile and keyFile
+func generateCertificate(certFile, keyFile string, hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader,
+		new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Ru-supplier"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(_TLS_SELF_SIGNED_YEARS, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range append(hosts, "localhost") {
+		if ip := net.ParseIP(host); ip != nil {
+			if !ip.IsUnspecified() {
+				template.IPAddresses = append(template.IPAddresses, ip)
+			}
+		} else if len(host) > 0 {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template,
+		&key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	if err = writePEM(keyFile, 0600, "EC PRIVATE KEY", keyDer); err != nil {
+		return err
+	}
+	return writePEM(certFile, 0644, "CERTIFICATE", der)
+}
+
+func writePEM(fname string, perm os.FileMode, blockType string,
+	der []byte) error {
+	file, err := os.OpenFile(fname, os.O_CREATE|os.O_WRONLY|os.O_TRUNC,
+		perm)
+	if err != nil {
+		return err
+	}
+	if err = pem.Encode(file, &pem.Block{Type: blockType,
+		Bytes: der}); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
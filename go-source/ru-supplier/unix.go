@@ -3,12 +3,14 @@
 package main
 
 import (
-// "fmt"
-// "time"
-
-// "github.com/salviati/go-qt5/qt5"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
+// InterfaceStart runs server without tray icon. Server is controlled
+// from dashboard, program exits on signal or on exit from dashboard
 func InterfaceStart(server ZakupkiProxyServer,
 	config ServerConfig) (err error) {
 
@@ -19,43 +21,28 @@ func InterfaceStart(server ZakupkiProxyServer,
 		panic("interface error: passed nil config")
 	}
 
-	// qt5.Main(func() {
-	// 	// w := qt5.NewWidget()
-	// 	// w.SetWindowTitle(qt5.Version())
-	// 	// w.SetSizev(300, 200)
-	// 	// defer w.Close()
-
-	// 	icon := qt5.NewIcon()
-	// 	icon.Init()
-	// 	// icon.InitWithFile("/home/ivan/gocode/src/bitbucket.org/pushkin_ivan/ru-supplier/src/eagle.ico")
-	// 	defer icon.Close()
-
-	// 	tray := qt5.NewSystemTray()
-	// 	tray.Init()
-	// 	defer tray.Close()
-
-	// 	tray.SetIcon(icon)
-	// 	time.Sleep(time.Second * 10)
-	// 	tray.SetVisible(true)
-	// 	time.Sleep(time.Second * 10)
-	// 	tray.SetVisible(false)
-
-	// 	fmt.Println(tray.IsVisible())
-	// 	// tray.
-
-	// 	// w.Show()
-	// 	qt5.Run()
-	// })
-
-	// icon := qt5.NewIconWithFile("src/eagle.ico")
-	// // icon.Init()
-	// tray := qt5.NewSystemTray()
-	// tray.SetIcon(icon)
-	// // tray.Init()
-
-	// time.Sleep(time.Minute)
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Start()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case err = <-errs:
+		log.Println("Cannot start server:", err)
+		return
+	case <-signals:
+	case <-server.ExitRequested():
+	}
 
-	// tray.Close()
-	// icon.Close()
+	if err = server.ShutDown(); err != nil {
+		log.Println("Cannot shutdown server", err)
+	}
+	if err = config.Save(); err != nil {
+		log.Println("Cannot save configures:", err)
+	}
 	return
 }
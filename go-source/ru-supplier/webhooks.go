@@ -0,0 +1,603 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const (
+	_DEAD_LETTERS_FILE_NAME   = "webhooks_dead.json"
+	_DEAD_LETTERS_TEMP_SUFFIX = ".tmp"
+
+	// count of delivery attempts before request goes to dead letters
+	_WEBHOOK_ATTEMPTS = 5
+	// delay before the second attempt, it grows twice with each attempt
+	_WEBHOOK_RETRY_DELAY = 5 * time.Second
+	_WEBHOOK_TIMEOUT     = 30 * time.Second
+	// size of delivery queue of each target
+	_WEBHOOK_QUEUE_SIZE = 1000
+
+	_WEBHOOK_SIGNATURE_HEADER = "X-Ru-Supplier-Signature"
+	_WEBHOOK_DELIVERY_HEADER  = "X-Ru-Supplier-Delivery"
+
+	// content types of json body and of body from template
+	_WEBHOOK_CONTENT_TYPE_JSON = "application/json; charset=utf-8"
+	_WEBHOOK_CONTENT_TYPE_TEXT = "text/plain; charset=utf-8"
+)
+
+// WebhookTarget is url which receives new orders. Orders of saved
+// searches from Feeds or from Groups are sent, if both are empty orders
+// of all feeds are sent. If Batch is true all new orders of one poll
+// are sent in one request, otherwise each order is sent separately.
+// Template is text/template of request body, by default body contains
+// WebhookPayload in json. ContentType is content type of body, by
+// default it is json without template and plain text with template. If
+// Secret is not empty request has header with HMAC-SHA256 signature of
+// body. If Alerts is true target receives alerts of starred orders
+type WebhookTarget struct {
+	Name        string
+	URL         string
+	Secret      string
+	Feeds       []string
+	Groups      []string
+	Batch       bool
+	Template    string
+	ContentType string `json:",omitempty"`
+	Alerts      bool
+}
+
+// Verify checks target fields
+func (t *WebhookTarget) Verify() error {
+	if len(t.Name) == 0 {
+		return errors.New("Webhook: empty name")
+	}
+	URL, err := url.Parse(t.URL)
+	if err != nil {
+		return err
+	}
+	if URL.Scheme != "http" && URL.Scheme != "https" {
+		return errors.New("Webhook: invalid url " + t.URL)
+	}
+	if len(t.Template) > 0 {
+		if _, err = parseWebhookTemplate(t.Template); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetContentType returns content type of request body
+func (t *WebhookTarget) GetContentType() string {
+	if len(t.ContentType) > 0 {
+		return t.ContentType
+	}
+	if len(t.Template) > 0 {
+		return _WEBHOOK_CONTENT_TYPE_TEXT
+	}
+	return _WEBHOOK_CONTENT_TYPE_JSON
+}
+
+// Match returns true if orders of feed must be sent to target
+func (t *WebhookTarget) Match(event *FeedEvent) bool {
+	if len(t.Feeds) == 0 && len(t.Groups) == 0 {
+		return true
+	}
+	if event.Search == nil {
+		return false
+	}
+	for _, slug := range t.Feeds {
+		if slug == event.Search.Slug {
+			return true
+		}
+	}
+	for _, group := range t.Groups {
+		for _, g := range event.Search.Groups {
+			if g == group {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func parseWebhookTemplate(text string) (*template.Template, error) {
+	return template.New("webhook").Funcs(template.FuncMap{
+		// json encodes value, so strings can be put into json template
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+	}).Parse(text)
+}
+
+// WebhookOrder is order in webhook payload
+type WebhookOrder struct {
+	*ArchiveRecord
+	Link string // order page on zakupki.gov.ru
+}
+
+// WebhookPayload is data which is sent to target. Order is set if
+// target receives orders one by one, Orders is set for batches. Alerts
+// of starred orders have Alert and Order
+type WebhookPayload struct {
+	Feed   string          // feed url
+	Search string          // saved search slug, empty if feed is not saved
+	Name   string          // saved search name
+	Order  *WebhookOrder   `json:",omitempty"`
+	Orders []*WebhookOrder `json:",omitempty"`
+	Alert  *StarAlert      `json:",omitempty"`
+}
+
+// WebhookRequest is prepared request to target
+type WebhookRequest struct {
+	ID       string
+	Target   string // target name
+	URL      string
+	Body     string
+	Attempts int
+	Error    string    // error of last attempt
+	Failed   time.Time // time of last attempt
+}
+
+// DeadLetters stores requests which were not delivered in json file.
+// Added requests are kept in memory until Save, so adding doesn't wait
+// for disk
+type DeadLetters struct {
+	mutex     sync.Mutex
+	fileMutex sync.Mutex // serializes writing of file
+	fname     string
+	list      []*WebhookRequest
+	changed   chan struct{}
+}
+
+func LoadDeadLetters(fname string) (letters *DeadLetters, err error) {
+	if len(fname) == 0 {
+		panic("DeadLetters: invalid file name")
+	}
+
+	letters = &DeadLetters{fname: fname, changed: make(chan struct{}, 1)}
+
+	var file *os.File
+	file, err = os.Open(fname)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	defer file.Close()
+
+	if err = json.NewDecoder(file).Decode(&letters.list); err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+// Save writes requests into temporary file and renames it
+func (d *DeadLetters) Save() error {
+	d.fileMutex.Lock()
+	defer d.fileMutex.Unlock()
+
+	// requests are encoded under mutex, because taken requests are
+	// changed by redelivery
+	d.mutex.Lock()
+	var data []byte
+	var err error
+	if len(d.list) > 0 {
+		data, err = json.Marshal(d.list)
+	}
+	d.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if data == nil {
+		if err := os.Remove(d.fname); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	tmpname := d.fname + _DEAD_LETTERS_TEMP_SUFFIX
+	file, err := os.Create(tmpname)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if errClose := file.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(tmpname)
+		return err
+	}
+	return os.Rename(tmpname, d.fname)
+}
+
+// Add appends request. File is not saved, receiver of Changed must
+// save it
+func (d *DeadLetters) Add(req *WebhookRequest) {
+	d.mutex.Lock()
+	d.list = append(d.list, req)
+	d.mutex.Unlock()
+	select {
+	case d.changed <- struct{}{}:
+	default:
+	}
+}
+
+// Changed returns channel which receives value when requests are added
+func (d *DeadLetters) Changed() <-chan struct{} {
+	return d.changed
+}
+
+// List returns copy of requests list
+func (d *DeadLetters) List() []*WebhookRequest {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	list := make([]*WebhookRequest, len(d.list))
+	for i, req := range d.list {
+		reqCopy := *req
+		list[i] = &reqCopy
+	}
+	return list
+}
+
+// Take removes all requests, saves file and returns removed requests
+func (d *DeadLetters) Take() ([]*WebhookRequest, error) {
+	d.mutex.Lock()
+	list := d.list
+	d.list = nil
+	d.mutex.Unlock()
+	if err := d.Save(); err != nil {
+		d.mutex.Lock()
+		d.list = append(list, d.list...)
+		d.mutex.Unlock()
+		return nil, err
+	}
+	return list, nil
+}
+
+// webhookWorker delivers requests of one target, so slow target
+// doesn't delay other targets
+type webhookWorker struct {
+	target   *WebhookTarget
+	template *template.Template
+	queue    chan *WebhookRequest
+}
+
+// Webhooks sends new orders to webhook targets. Requests which were
+// not delivered after all attempts are saved in dead letters
+type Webhooks struct {
+	workers    []*webhookWorker
+	dead       *DeadLetters
+	client     *http.Client
+	retryDelay time.Duration
+
+	mutex sync.Mutex
+	stop  chan struct{}
+	// cancel cancels requests which are sent when delivery is stopped
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	seq    uint64
+}
+
+func NewWebhooks(targets []*WebhookTarget, dead *DeadLetters) *Webhooks {
+	if dead == nil {
+		panic("NewWebhooks(): passed nil dead letters")
+	}
+	w := &Webhooks{
+		dead:       dead,
+		client:     &http.Client{Timeout: _WEBHOOK_TIMEOUT},
+		retryDelay: _WEBHOOK_RETRY_DELAY,
+	}
+	for _, target := range targets {
+		if err := target.Verify(); err != nil {
+			log.Println("Skip webhook:", err)
+			continue
+		}
+		worker := &webhookWorker{target: target}
+		if len(target.Template) > 0 {
+			worker.template, _ = parseWebhookTemplate(target.Template)
+		}
+		w.workers = append(w.workers, worker)
+	}
+	return w
+}
+
+// Start starts delivery in background
+func (w *Webhooks) Start() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.stop != nil {
+		return errors.New("Webhooks are already running")
+	}
+	w.stop = make(chan struct{})
+	var ctx context.Context
+	ctx, w.cancel = context.WithCancel(context.Background())
+	for _, worker := range w.workers {
+		worker.queue = make(chan *WebhookRequest, _WEBHOOK_QUEUE_SIZE)
+		w.wg.Add(1)
+		go w.run(ctx, worker, worker.queue, w.stop)
+	}
+	w.wg.Add(1)
+	go w.saveDead(w.stop)
+	return nil
+}
+
+// Stop stops delivery and cancels sent requests. Requests which were
+// not delivered yet are saved in dead letters
+func (w *Webhooks) Stop() error {
+	w.mutex.Lock()
+	if w.stop == nil {
+		w.mutex.Unlock()
+		return errors.New("Webhooks are already stopped")
+	}
+	close(w.stop)
+	w.cancel()
+	w.stop = nil
+	w.mutex.Unlock()
+	w.wg.Wait()
+	return w.dead.Save()
+}
+
+// saveDead saves dead letters when they are changed
+func (w *Webhooks) saveDead(stop chan struct{}) {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.dead.Changed():
+			if err := w.dead.Save(); err != nil {
+				log.Println("Can't save dead letters:", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Notify prepares requests with new orders and puts them into queues
+// of matching targets
+func (w *Webhooks) Notify(event *FeedEvent) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.stop == nil {
+		return
+	}
+
+	for _, worker := range w.workers {
+		if !worker.target.Match(event) {
+			continue
+		}
+		for _, payload := range makePayloads(event, worker.target.Batch) {
+			w.enqueue(worker, payload)
+		}
+	}
+}
+
+// Alert puts alert of starred order into queues of targets which
+// receive alerts
+func (w *Webhooks) Alert(alert *StarAlert) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.stop == nil {
+		return
+	}
+
+	payload := &WebhookPayload{
+		Order: &WebhookOrder{alert.Order, MakeLink(alert.Order.OrderId)},
+		Alert: alert,
+	}
+	for _, worker := range w.workers {
+		if worker.target.Alerts {
+			w.enqueue(worker, payload)
+		}
+	}
+}
+
+// enqueue makes request and puts it into queue of worker. Mutex must
+// be locked
+func (w *Webhooks) enqueue(worker *webhookWorker, payload *WebhookPayload) {
+	w.seq++
+	req, err := worker.request(payload,
+		strconv.FormatInt(time.Now().Unix(), 10)+"-"+
+			strconv.FormatUint(w.seq, 10))
+	if err != nil {
+		log.Println("Can't make webhook request:", err)
+		return
+	}
+	select {
+	case worker.queue <- req:
+	default:
+		w.fail(req, errors.New("Queue is full"))
+	}
+}
+
+func makePayloads(event *FeedEvent, batch bool) []*WebhookPayload {
+	payload := WebhookPayload{Feed: event.URL, Search: event.Slug()}
+	if event.Search != nil {
+		payload.Name = event.Search.Name
+	}
+	orders := make([]*WebhookOrder, len(event.Items))
+	for i, item := range event.Items {
+		orders[i] = &WebhookOrder{item.ArchiveRecord, MakeLink(item.OrderId)}
+	}
+	if batch {
+		payload.Orders = orders
+		return []*WebhookPayload{&payload}
+	}
+	payloads := make([]*WebhookPayload, len(orders))
+	for i, order := range orders {
+		p := payload
+		p.Order = order
+		payloads[i] = &p
+	}
+	return payloads
+}
+
+// request renders request body by target template or in json
+func (worker *webhookWorker) request(payload *WebhookPayload,
+	id string) (*WebhookRequest, error) {
+	buff := bytes.NewBuffer(nil)
+	var err error
+	if worker.template != nil {
+		err = worker.template.Execute(buff, payload)
+	} else {
+		err = json.NewEncoder(buff).Encode(payload)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &WebhookRequest{
+		ID:     id,
+		Target: worker.target.Name,
+		URL:    worker.target.URL,
+		Body:   buff.String(),
+	}, nil
+}
+
+func (w *Webhooks) run(ctx context.Context, worker *webhookWorker,
+	queue chan *WebhookRequest, stop chan struct{}) {
+	defer w.wg.Done()
+	for {
+		select {
+		case req := <-queue:
+			w.deliver(ctx, worker, req, stop)
+		case <-stop:
+			// save requests which are left in queue
+			for {
+				select {
+				case req := <-queue:
+					w.fail(req, errors.New("Delivery was stopped"))
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver sends request with retries
+func (w *Webhooks) deliver(ctx context.Context, worker *webhookWorker,
+	req *WebhookRequest, stop chan struct{}) {
+	delay := w.retryDelay
+	for {
+		err := w.send(ctx, worker.target, req)
+		req.Attempts++
+		if err == nil {
+			return
+		}
+		log.Printf("Webhook %s delivery %s failed: %s\n",
+			req.Target, req.ID, err)
+		if req.Attempts >= _WEBHOOK_ATTEMPTS {
+			w.fail(req, err)
+			return
+		}
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-stop:
+			w.fail(req, err)
+			return
+		}
+	}
+}
+
+// send sends request once. Any status except 2xx is error. Request is
+// cancelled when ctx is done
+func (w *Webhooks) send(ctx context.Context, target *WebhookTarget,
+	req *WebhookRequest) error {
+	httpReq, err := http.NewRequest("POST", req.URL,
+		bytes.NewBufferString(req.Body))
+	if err != nil {
+		return err
+	}
+	httpReq = httpReq.WithContext(ctx)
+	httpReq.Header.Set("Content-Type", target.GetContentType())
+	httpReq.Header.Set(_WEBHOOK_DELIVERY_HEADER, req.ID)
+	if len(target.Secret) > 0 {
+		httpReq.Header.Set(_WEBHOOK_SIGNATURE_HEADER,
+			"sha256="+Sign(target.Secret, req.Body))
+	}
+
+	resp, err := w.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("Target return status " + resp.Status)
+	}
+	return nil
+}
+
+// fail puts request into dead letters, they are saved in background
+func (w *Webhooks) fail(req *WebhookRequest, err error) {
+	req.Error = err.Error()
+	req.Failed = time.Now()
+	w.dead.Add(req)
+}
+
+// Redeliver puts all dead letters into delivery queues again. Letters
+// of targets which are not in config are kept
+func (w *Webhooks) Redeliver() (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.stop == nil {
+		return 0, errors.New("Webhooks are stopped")
+	}
+
+	list, err := w.dead.Take()
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for _, req := range list {
+		var worker *webhookWorker
+		for _, wk := range w.workers {
+			if wk.target.Name == req.Target {
+				worker = wk
+				break
+			}
+		}
+		if worker == nil {
+			w.dead.Add(req)
+			continue
+		}
+		req.Attempts = 0
+		req.URL = worker.target.URL
+		select {
+		case worker.queue <- req:
+			count++
+		default:
+			w.fail(req, errors.New("Queue is full"))
+		}
+	}
+	return count, nil
+}
+
+// Sign returns hex encoded HMAC-SHA256 of body with key secret
+func Sign(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// webhookRequest is request received by test target
+type webhookRequest struct {
+	header http.Header
+	body   string
+}
+
+// webhookTarget is test server which answers with statuses from list,
+// the last status is repeated
+type webhookTarget struct {
+	mutex    sync.Mutex
+	statuses []int
+	requests []*webhookRequest
+	received chan struct{}
+}
+
+func newWebhookTarget(statuses ...int) (*webhookTarget, *httptest.Server) {
+	target := &webhookTarget{
+		statuses: statuses,
+		received: make(chan struct{}, 100),
+	}
+	return target, httptest.NewServer(target)
+}
+
+func (t *webhookTarget) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	t.mutex.Lock()
+	t.requests = append(t.requests, &webhookRequest{r.Header, string(body)})
+	status := t.statuses[0]
+	if len(t.statuses) > 1 {
+		t.statuses = t.statuses[1:]
+	}
+	t.mutex.Unlock()
+	w.WriteHeader(status)
+	t.received <- struct{}{}
+}
+
+// wait waits for count requests
+func (t *webhookTarget) wait(tt *testing.T, count int) []*webhookRequest {
+	for i := 0; i < count; i++ {
+		select {
+		case <-t.received:
+		case <-time.After(5 * time.Second):
+			tt.Fatalf("received %d requests, expected %d", i, count)
+		}
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]*webhookRequest(nil), t.requests...)
+}
+
+func startWebhooks(t *testing.T, target *WebhookTarget) (*Webhooks,
+	*DeadLetters, string) {
+	dir, err := ioutil.TempDir("", "webhooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead, err := LoadDeadLetters(filepath.Join(dir, _DEAD_LETTERS_FILE_NAME))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWebhooks([]*WebhookTarget{target}, dead)
+	w.retryDelay = 10 * time.Millisecond
+	if err = w.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return w, dead, dir
+}
+
+func testFeedEvent() *FeedEvent {
+	return &FeedEvent{
+		URL: "http://zakupki.gov.ru/epz/order/quicksearch/search.html",
+		Items: []*FeedItem{
+			{1, &ArchiveRecord{Order: Order{OrderId: "0123"}}},
+		},
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	target, server := newWebhookTarget(http.StatusOK)
+	defer server.Close()
+	w, _, dir := startWebhooks(t, &WebhookTarget{
+		Name:   "test",
+		URL:    server.URL,
+		Secret: "secret",
+	})
+	defer os.RemoveAll(dir)
+	defer w.Stop()
+
+	w.Notify(testFeedEvent())
+	req := target.wait(t, 1)[0]
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte(req.body))
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if signature := req.header.Get(_WEBHOOK_SIGNATURE_HEADER); signature != expected {
+		t.Errorf("signature %q, expected %q", signature, expected)
+	}
+	if len(req.header.Get(_WEBHOOK_DELIVERY_HEADER)) == 0 {
+		t.Error("empty delivery id")
+	}
+	if contentType := req.header.Get("Content-Type"); contentType != _WEBHOOK_CONTENT_TYPE_JSON {
+		t.Errorf("content type %q", contentType)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	target, server := newWebhookTarget(http.StatusInternalServerError,
+		http.StatusOK)
+	defer server.Close()
+	w, dead, dir := startWebhooks(t, &WebhookTarget{
+		Name:     "test",
+		URL:      server.URL,
+		Template: "{{.Order.OrderId}}",
+	})
+	defer os.RemoveAll(dir)
+
+	w.Notify(testFeedEvent())
+	requests := target.wait(t, 2)
+	// worker sends requests one by one, so the next request is sent
+	// after the retry is delivered
+	w.Notify(testFeedEvent())
+	target.wait(t, 1)
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	if requests[0].body != "0123" || requests[1].body != "0123" {
+		t.Errorf("bodies %q and %q", requests[0].body, requests[1].body)
+	}
+	if requests[0].header.Get(_WEBHOOK_DELIVERY_HEADER) !=
+		requests[1].header.Get(_WEBHOOK_DELIVERY_HEADER) {
+		t.Error("retry has another delivery id")
+	}
+	if contentType := requests[1].header.Get("Content-Type"); contentType != _WEBHOOK_CONTENT_TYPE_TEXT {
+		t.Errorf("content type %q", contentType)
+	}
+	for _, req := range dead.List() {
+		if req.ID == requests[0].header.Get(_WEBHOOK_DELIVERY_HEADER) {
+			t.Errorf("delivered request is in dead letters: %s", req.Error)
+		}
+	}
+}
+
+func TestWebhookDeadLetters(t *testing.T) {
+	target, server := newWebhookTarget(http.StatusInternalServerError)
+	defer server.Close()
+	w, dead, dir := startWebhooks(t, &WebhookTarget{
+		Name: "test",
+		URL:  server.URL,
+	})
+	defer os.RemoveAll(dir)
+
+	w.Notify(testFeedEvent())
+	target.wait(t, _WEBHOOK_ATTEMPTS)
+	// the last failure is registered after response
+	deadline := time.Now().Add(5 * time.Second)
+	for len(dead.List()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := w.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	list := dead.List()
+	if len(list) != 1 {
+		t.Fatalf("%d dead letters, expected 1", len(list))
+	}
+	if list[0].Attempts != _WEBHOOK_ATTEMPTS || list[0].Target != "test" ||
+		len(list[0].Error) == 0 {
+		t.Errorf("dead letter %+v", list[0])
+	}
+
+	saved, err := LoadDeadLetters(filepath.Join(dir, _DEAD_LETTERS_FILE_NAME))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.List()) != 1 {
+		t.Errorf("%d saved dead letters, expected 1", len(saved.List()))
+	}
+}
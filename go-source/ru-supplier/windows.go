@@ -352,7 +352,11 @@ func InterfaceStart(server ZakupkiProxyServer,
 	})
 
 	openDirAction.Triggered().Attach(func() {
-		err = exec.Command("cmd", "/C", "start", ".").Start()
+		dir := config.GetDataDir()
+		if len(dir) == 0 {
+			dir = "."
+		}
+		err = exec.Command("cmd", "/C", "start", dir).Start()
 		if err != nil {
 			log.Println("Cannot open program directory:", err)
 		} else {
@@ -373,6 +377,14 @@ func InterfaceStart(server ZakupkiProxyServer,
 		walk.App().Exit(0)
 	})
 
+	// exit is requested from dashboard
+	go func() {
+		<-server.ExitRequested()
+		mw.Synchronize(func() {
+			walk.App().Exit(0)
+		})
+	}()
+
 	/* * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * *
 	 *                       END EVENT HANDLERS                    *
 	 * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * * */
@@ -9,8 +9,8 @@ const _CONFIG_FILE = "config.json"
 
 const _LOCAL_PROXY_DEF_HOST = "proxy-zakupki-gov-ru.local"
 
-// GetHttpHost tries load configs from file and returns default value
-// on failure
+// GetHttpHost tries load configs from file and returns public url of
+// proxy or its host. Returns default value on failure
 func GetHttpHost() string {
 	file, err := os.Open(_CONFIG_FILE)
 	if err == nil {
@@ -18,12 +18,25 @@ func GetHttpHost() string {
 
 		var conf *struct {
 			Host, Port string
+			BaseURL    string
+			TLS        *struct{}
 		}
 
 		if err = json.NewDecoder(file).Decode(&conf); err == nil {
+			if len(conf.BaseURL) > 0 {
+				return conf.BaseURL
+			}
 			if len(conf.Host)*len(conf.Port) > 0 {
 				var httpHost = conf.Host
 
+				// proxy serves https if TLS is set
+				if conf.TLS != nil {
+					if conf.Port != "443" {
+						httpHost += ":" + conf.Port
+					}
+					return "https://" + httpHost
+				}
+
 				if conf.Port != "80" {
 					httpHost += ":" + conf.Port
 				}
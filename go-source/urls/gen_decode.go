@@ -0,0 +1,31 @@
+// +build ignore
+
+// gen_decode.go copies search url decoder of proxy into urls, so both
+// programs decode links in the same way. Run go generate after changes
+// of ../ru-supplier/decode.go
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+)
+
+const (
+	_SOURCE_FILE = "../ru-supplier/decode.go"
+	_TARGET_FILE = "decode.go"
+	_HEADER      = "// Code generated by gen_decode.go from " + _SOURCE_FILE +
+		"; DO NOT EDIT.\n\n"
+)
+
+func main() {
+	data, err := ioutil.ReadFile(_SOURCE_FILE)
+	if err != nil {
+		log.Fatal(err)
+	}
+	buff := bytes.NewBufferString(_HEADER)
+	buff.Write(data)
+	if err = ioutil.WriteFile(_TARGET_FILE, buff.Bytes(), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
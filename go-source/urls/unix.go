@@ -2,6 +2,168 @@
 
 package main
 
+import (
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Output formats
+const (
+	_FORMAT_RSS  = "rss"  // feed link
+	_FORMAT_OPML = "opml" // opml outline which can be imported by proxy
+	_FORMAT_JSON = "json" // saved search for json api /api/searches
+)
+
+const (
+	_DEFAULT_TITLE = "Закупки"
+	_FEED_LINK     = "http://zakupki.gov.ru"
+)
+
+const _USAGE = `Usage: urls [options] [url ...]
+
+Converts urls of search pages of zakupki.gov.ru into feed links of local
+proxy. With option -decode explains what feed links search for. If urls
+are not passed, they are read from stdin one per line.
+
+Options:
+`
+
+// outline is feed outline of opml subscription list
+type outline struct {
+	XMLName xml.Name `xml:"outline"`
+	Text    string   `xml:"text,attr"`
+	Title   string   `xml:"title,attr"`
+	Type    string   `xml:"type,attr"`
+	XMLURL  string   `xml:"xmlUrl,attr"`
+	HTMLURL string   `xml:"htmlUrl,attr"`
+}
+
+// savedSearch is saved search entry of proxy, slug is made by proxy
+type savedSearch struct {
+	Name string
+	URL  string // url of csv stream
+}
+
 func main() {
+	var (
+		host = flag.String("host", GetHttpHost(),
+			"host of local proxy or its public url with path prefix")
+		format = flag.String("format", _FORMAT_RSS,
+			"output format: rss, opml or json")
+		name = flag.String("name", "",
+			"feed title for opml and json, search string by default")
+		decode = flag.Bool("decode", false,
+			"decode feed links and print search parameters")
+	)
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, _USAGE)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	switch *format {
+	case _FORMAT_RSS, _FORMAT_OPML, _FORMAT_JSON:
+	default:
+		fmt.Fprintf(os.Stderr, "urls: invalid format %q\n", *format)
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var rawurls []string
+	if flag.NArg() > 0 {
+		rawurls = flag.Args()
+	} else {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); len(line) > 0 {
+				rawurls = append(rawurls, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fmt.Fprintln(os.Stderr, "urls: cannot read stdin:", err)
+			os.Exit(1)
+		}
+	}
+
+	failed := false
+	for i, rawurl := range rawurls {
+		var err error
+		if *decode {
+			if i > 0 {
+				fmt.Println()
+			}
+			err = writeDecoded(os.Stdout, rawurl, len(rawurls) > 1)
+		} else {
+			err = write(os.Stdout, rawurl, *host, *format, *name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "urls: %s: %s\n", rawurl, err)
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// write writes feed link of search page url in passed format
+func write(w io.Writer, rawurl, host, format, name string) error {
+	URL, err := url.Parse(rawurl)
+	if err != nil {
+		return err
+	}
+	feedURL, err := generateURL(URL, host)
+	if err != nil {
+		return err
+	}
+	if len(name) == 0 {
+		name = strings.TrimSpace(URL.Query().Get("searchString"))
+	}
+	if len(name) == 0 {
+		name = _DEFAULT_TITLE
+	}
+
+	switch format {
+	case _FORMAT_OPML:
+		data, err := xml.Marshal(&outline{
+			Text:    name,
+			Title:   name,
+			Type:    "rss",
+			XMLURL:  feedURL.String(),
+			HTMLURL: _FEED_LINK,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case _FORMAT_JSON:
+		return json.NewEncoder(w).Encode(&savedSearch{name,
+			feedURL.Query().Get("url")})
+	}
+	_, err = fmt.Fprintln(w, feedURL)
+	return err
+}
 
+// writeDecoded writes search parameters of feed link, header contains
+// passed url
+func writeDecoded(w io.Writer, rawurl string, header bool) error {
+	decoded, err := DecodeSearchURL(rawurl)
+	if err != nil {
+		return err
+	}
+	if header {
+		if _, err = fmt.Fprintln(w, rawurl); err != nil {
+			return err
+		}
+	}
+	_, err = io.WriteString(w, decoded.String())
+	return err
 }
@@ -1,6 +1,17 @@
+//go:generate go run gen_decode.go
+
 package main
 
-import "net/url"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Path of feeds of local proxy
+const _PATH_TO_RSS = "/rss"
 
 const (
 	_URL_REQUIRED_SCHEME               = "http"
@@ -12,32 +23,47 @@ const (
 	_URL_REQUIRED_EXTENDED_SEARCH_PATH = "/epz/order/extendedsearch/orderCsvSettings/extendedSearch/download.html"
 )
 
-var Paths = map[string]string{
+// Value of param conf of csv stream: all columns are included
+const _URL_CSV_COLUMNS = "true;true;true;true;true;true;true;true;" +
+	"true;true;true;true;true;true;true;true;true;true;"
+
+// SearchPaths maps paths of search pages to paths of csv streams
+var SearchPaths = map[string]string{
 	"/epz/order/extendedsearch/search.html": _URL_REQUIRED_EXTENDED_SEARCH_PATH,
 	"/epz/order/quicksearch/search.html":    _URL_REQUIRED_QUICK_SEARCH_PATH,
 	"/epz/order/quicksearch/update.html":    _URL_REQUIRED_QUICK_SEARCH_PATH,
 }
 
-func generateURL(URL *url.URL, host string) *url.URL {
+// generateURL converts url of search page into feed link of local
+// proxy with passed host or public url with scheme and path prefix.
+// URL isn't changed, url of csv stream is in param url of feed link.
+// Error explains why url is rejected
+func generateURL(URL *url.URL, host string) (*url.URL, error) {
 	if !URL.IsAbs() {
-		return nil
+		return nil, errors.New("url isn't absolute")
 	}
 	if URL.Scheme != _URL_REQUIRED_SCHEME {
-		return nil
+		return nil, fmt.Errorf("invalid url scheme %q, required %q",
+			URL.Scheme, _URL_REQUIRED_SCHEME)
 	}
-	if URL.Host != _URL_REQUIRED_HOST {
-		if URL.Host != _URL_REQUIRED_ALIAS_HOST {
-			return nil
+	csvURL := *URL
+	if csvURL.Host != _URL_REQUIRED_HOST {
+		if csvURL.Host != _URL_REQUIRED_ALIAS_HOST {
+			return nil, fmt.Errorf("invalid url host %q, required %q",
+				csvURL.Host, _URL_REQUIRED_HOST)
 		}
+		// proxy loads only from main host
+		csvURL.Host = _URL_REQUIRED_HOST
 	}
-	if path, ok := Paths[URL.Path]; ok {
-		URL.Path = path
+	if path, ok := SearchPaths[csvURL.Path]; ok {
+		csvURL.Path = path
 	} else {
-		return nil
+		return nil, fmt.Errorf("invalid url path %q, required path of "+
+			"quick or extended search page", csvURL.Path)
 	}
 
-	vals := URL.Query()
-	if URL.Path == _URL_REQUIRED_QUICK_SEARCH_PATH {
+	vals := csvURL.Query()
+	if csvURL.Path == _URL_REQUIRED_QUICK_SEARCH_PATH {
 		vals.Set("quickSearch", "true")
 	} else {
 		vals.Set("quickSearch", "false")
@@ -45,16 +71,33 @@ func generateURL(URL *url.URL, host string) *url.URL {
 	vals.Set("sortBy", _URL_REQUIRED_SORTING_TYPE)
 	vals.Set("sortDirection", _URL_REQUIRED_SORTING_DIRECTION)
 	vals.Set("userId", "null")
-	vals.Set("conf", "true;true;true;true;true;true;true;true;"+
-		"true;true;true;true;true;true;true;true;true;true;")
-	URL.RawQuery = vals.Encode()
-
-	return &url.URL{
-		Scheme: "http",
-		Host:   host,
-		Path:   "/rss",
-		RawQuery: url.Values{
-			"url": {URL.String()},
-		}.Encode(),
+	vals.Set("conf", _URL_CSV_COLUMNS)
+	csvURL.RawQuery = vals.Encode()
+
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	feedURL, err := url.Parse(strings.TrimRight(host, "/") + _PATH_TO_RSS)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy host: %s", err)
+	}
+	feedURL.RawQuery = url.Values{
+		"url": {csvURL.String()},
+	}.Encode()
+	return feedURL, nil
+}
+
+// String returns search parameters and problems one per line
+func (d *DecodedSearch) String() string {
+	buff := bytes.NewBuffer(nil)
+	for _, param := range d.Params {
+		fmt.Fprintf(buff, "%s: %s\n", param.Name, param.Value)
+	}
+	if len(d.Params) == 0 {
+		fmt.Fprintln(buff, "Параметры поиска не заданы")
+	}
+	for _, problem := range d.Problems {
+		fmt.Fprintf(buff, "Проблема: %s\n", problem)
 	}
+	return buff.String()
 }
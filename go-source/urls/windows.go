@@ -4,6 +4,7 @@ package main
 
 import (
 	"net/url"
+	"strings"
 
 	"github.com/lxn/walk"
 	. "github.com/lxn/walk/declarative"
@@ -13,7 +14,8 @@ const (
 	_WIN_TITLE       = "Генератор ссылок"
 	_WIN_GEN_BUTTON  = "Генерировать"
 	_WIN_COPY_BUTTON = "Копировать"
-	_WIN_LABEL_HOST  = "Локальный хост"
+	_WIN_DEC_BUTTON  = "Расшифровать"
+	_WIN_LABEL_HOST  = "Адрес прокси"
 	_WIN_LABEL_LINK  = "Ссылка на страницу с закупками"
 )
 
@@ -52,12 +54,22 @@ func main() {
 								return
 							}
 
-							genURL := generateURL(URL, le.Text())
-							if genURL != nil {
+							genURL, err := generateURL(URL, le.Text())
+							if err == nil {
 								te.SetText(genURL.String())
 							}
 						},
 					},
+					PushButton{
+						Text: _WIN_DEC_BUTTON,
+						OnClicked: func() {
+							decoded, err := DecodeSearchURL(te.Text())
+							if err == nil {
+								te.SetText(strings.Replace(decoded.String(),
+									"\n", "\r\n", -1))
+							}
+						},
+					},
 					PushButton{
 						Text: _WIN_COPY_BUTTON,
 						OnClicked: func() {
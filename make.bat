@@ -97,6 +97,12 @@ if not exist "%GOPATH%\src\github.com/gorilla/feeds" (
 )
 echo Package github.com/gorilla/feeds... ok
 
+if not exist "%GOPATH%\src\go.etcd.io/bbolt" (
+	echo Downloading package go.etcd.io/bbolt...
+	go get go.etcd.io/bbolt
+)
+echo Package go.etcd.io/bbolt... ok
+
 if not exist "%GOPATH%\src\github.com/lxn/walk" (
 	echo Downloading package github.com/lxn/walk...
 	go get github.com/lxn/walk